@@ -0,0 +1,522 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	. "github.com/timob/ls/lib"
+)
+
+// sgr is the parameter list of an ANSI Select Graphic Rendition escape
+// sequence, as used in LS_COLORS, eg. "01;34" for bold blue, "38;5;208" for
+// color 208 of the 256 color palette or "38;2;255;128;0" for a 24-bit color.
+type sgr string
+
+var defaultColors = map[string]sgr{
+	"rs": "0",
+	"di": "01;34",
+	"ln": "01;36",
+	"pi": "40;33",
+	"so": "01;35",
+	"bd": "40;33;01",
+	"cd": "40;33;01",
+	"or": "40;31",
+	"ex": "01;32",
+	"do": "01;35",
+	"su": "37;41",
+	"sg": "30;43",
+	"tw": "30;42",
+	"ow": "34;42",
+	"st": "37;44",
+}
+
+// colorKeys are the two letter LS_COLORS keys, lc, rc and ec hold escape
+// sequences, the others SGR parameters.
+var colorKeys = map[string]bool{
+	"lc": true, "rc": true, "ec": true, "rs": true, "no": true, "fi": true,
+	"di": true, "ln": true, "pi": true, "so": true, "bd": true, "cd": true,
+	"mi": true, "or": true, "ex": true, "do": true, "su": true, "sg": true,
+	"st": true, "ow": true, "tw": true, "ca": true, "mh": true, "cl": true,
+}
+
+var fileColors map[string]sgr
+
+// colorLeft and colorRight surround SGR parameters to make an escape
+// sequence, colorEnd replaces colorLeft, rs and colorRight after a name if
+// set.
+var colorLeft = "\x1b["
+var colorRight = "m"
+var colorEnd string
+var colorEndSet bool
+
+// colorPattern is a *PATTERN entry of LS_COLORS, matched against the names
+// of regular files. Patterns are matched ignoring case unless another
+// pattern differing only in case has a different color.
+type colorPattern struct {
+	pattern       string
+	caseSensitive bool
+	color         sgr
+}
+
+// colorPatterns are kept in reverse order so that later entries take
+// precedence, as in GNU ls.
+var colorPatterns []colorPattern
+
+// colorSymlinkAsTarget is set by ln=target, symlinks are colored like the
+// file they point to.
+var colorSymlinkAsTarget bool
+
+var useColor bool
+
+// colorSet is set when a command line option chose whether to use color,
+// overriding the environment
+var colorSet bool
+
+// printColorTable is set by --print-colors
+var printColorTable bool
+
+// usedColor is set once an escape sequence has been written
+var usedColor bool
+
+// parseSGR checks that s is a valid list of SGR parameters, numbers separated
+// by ';', where the extended color parameters 38, 48 and 58 are followed by
+// 5 and a palette index or 2 and red, green and blue components.
+func parseSGR(s string) (sgr, error) {
+	if s == "" {
+		return "", nil
+	}
+	params := strings.Split(s, ";")
+	for i := 0; i < len(params); i++ {
+		n, err := strconv.Atoi(params[i])
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid SGR parameter %q in %q", params[i], s)
+		}
+		if n != 38 && n != 48 && n != 58 {
+			continue
+		}
+		var components int
+		if i+1 < len(params) && params[i+1] == "5" {
+			components = 1
+		} else if i+1 < len(params) && params[i+1] == "2" {
+			components = 3
+		} else {
+			return "", fmt.Errorf("invalid extended color in %q", s)
+		}
+		i += 2
+		if i+components > len(params) {
+			return "", fmt.Errorf("invalid extended color in %q", s)
+		}
+		for _, c := range params[i : i+components] {
+			if v, err := strconv.Atoi(c); err != nil || v < 0 || v > 255 {
+				return "", fmt.Errorf("invalid color component %q in %q", c, s)
+			}
+		}
+		i += components - 1
+	}
+	return sgr(s), nil
+}
+
+// unescapeColor expands the escapes allowed in LS_COLORS keys and values,
+// backslash escapes such as \e, \_ for space, \NNN octal and \xHH hex, and
+// caret notation such as ^[.
+func unescapeColor(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '^' && i+1 < len(s) {
+			i++
+			if s[i] == '?' {
+				b.WriteByte(127)
+			} else {
+				b.WriteByte(s[i] & 0x1f)
+			}
+			continue
+		}
+		if c != '\\' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = s[i]; c {
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'e':
+			b.WriteByte(0x1b)
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case '?':
+			b.WriteByte(127)
+		case '_':
+			b.WriteByte(' ')
+		case 'x', 'X':
+			j := i + 1
+			for j < len(s) && j < i+3 && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+				j++
+			}
+			n, _ := strconv.ParseUint(s[i+1:j], 16, 8)
+			b.WriteByte(byte(n))
+			i = j - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+				j++
+			}
+			n, _ := strconv.ParseUint(s[i:j], 8, 8)
+			b.WriteByte(byte(n))
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// splitUnescaped splits s at the first n-1 occurrences of sep which aren't
+// escaped with a backslash, or all of them if n < 0.
+func splitUnescaped(s string, sep byte, n int) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s) && n != 1; i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == sep {
+			parts = append(parts, s[start:i])
+			start = i + 1
+			n--
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseLSColors adds the entries of an LS_COLORS value, key=value pairs
+// separated by ':', to the color settings.
+func parseLSColors(env string) {
+	for _, def := range splitUnescaped(env, ':', -1) {
+		tokens := splitUnescaped(def, '=', 2)
+		if len(tokens) != 2 {
+			continue
+		}
+		key, value := unescapeColor(tokens[0]), unescapeColor(tokens[1])
+		if !setColorEntry(key, value) {
+			log.Printf("ignoring unparsable LS_COLORS entry %s", def)
+		}
+	}
+}
+
+// setColorEntry sets key, a two letter key or *PATTERN, to value, reporting
+// whether the entry is valid.
+func setColorEntry(key, value string) bool {
+	switch key {
+	case "lc":
+		colorLeft = value
+		return true
+	case "rc":
+		colorRight = value
+		return true
+	case "ec":
+		colorEnd = value
+		colorEndSet = true
+		return true
+	case "cl":
+		// names are never cleared to the end of the line
+		return true
+	case "ln":
+		if value == "target" {
+			colorSymlinkAsTarget = true
+			delete(fileColors, "ln")
+			return true
+		}
+	}
+
+	color, err := parseSGR(value)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(key, "*") {
+		p := colorPattern{pattern: key, color: color}
+		for i := range colorPatterns {
+			other := &colorPatterns[i]
+			if other.pattern != p.pattern && strings.EqualFold(other.pattern, p.pattern) && other.color != p.color {
+				other.caseSensitive = true
+				p.caseSensitive = true
+			}
+		}
+		colorPatterns = append([]colorPattern{p}, colorPatterns...)
+		return true
+	}
+	if !colorKeys[key] {
+		return false
+	}
+	fileColors[key] = color
+	return true
+}
+
+// loadColors sets up the color settings from the defaults, then the
+// dircolors database and LS_COLORS, each overriding the ones before.
+func loadColors() {
+	fileColors = make(map[string]sgr)
+	for k, v := range defaultColors {
+		fileColors[k] = v
+	}
+	if fileName := dircolorsFile(); fileName != "" {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			log.Print(err)
+		} else {
+			parseDircolors(fileName, string(data))
+		}
+	}
+	if env := os.Getenv("LSCOLORS"); env != "" {
+		parseBSDColors(env)
+	}
+	parseLSColors(os.Getenv("LS_COLORS"))
+}
+
+// colorFromEnv reports whether to use color when no option chose. Following
+// the CLICOLOR convention, a non empty NO_COLOR disables color, otherwise
+// CLICOLOR_FORCE enables it and CLICOLOR enables it if standard output is a
+// terminal. CLICOLOR_FORCE and CLICOLOR set to "" or "0" count as unset, and
+// unlike BSD ls CLICOLOR_FORCE doesn't need CLICOLOR.
+func colorFromEnv() bool {
+	enabled := func(name string) bool {
+		v := os.Getenv(name)
+		return v != "" && v != "0"
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if enabled("CLICOLOR_FORCE") {
+		return true
+	}
+	if enabled("CLICOLOR") {
+		return IsTerminal(os.Stdout)
+	}
+	return false
+}
+
+// bsdColorKeys are the keys set by the foreground and background color
+// pairs of BSD LSCOLORS, in order.
+var bsdColorKeys = []string{"di", "ln", "so", "pi", "ex", "bd", "cd", "su", "sg", "tw", "ow"}
+
+// parseBSDColors sets colors from a BSD LSCOLORS value, a foreground and
+// background color letter for each of bsdColorKeys. The letters a to h are
+// black, red, green, brown, blue, magenta, cyan and light grey, x is the
+// default color. Like FreeBSD ls, an upper case foreground is bold, an upper
+// case background is underlined and the digits 0 to 7 are accepted as a
+// legacy form of a to h.
+func parseBSDColors(env string) {
+	for i, key := range bsdColorKeys {
+		if 2*i+1 >= len(env) {
+			break
+		}
+		var params []string
+		var bold, underline bool
+		var colors [2]string
+		for j := 0; j < 2; j++ {
+			switch c := env[2*i+j]; {
+			case c >= '0' && c <= '7':
+				colors[j] = string(c)
+			case c >= 'a' && c <= 'h':
+				colors[j] = string('0' + c - 'a')
+			case c >= 'A' && c <= 'H':
+				colors[j] = string('0' + c - 'A')
+				if j == 0 {
+					bold = true
+				} else {
+					underline = true
+				}
+			case c == 'x':
+			case c == 'X':
+				if j == 1 {
+					underline = true
+				}
+			default:
+				log.Printf("ignoring invalid character '%c' in LSCOLORS", c)
+			}
+		}
+		if bold {
+			params = append(params, "01")
+		}
+		if underline {
+			params = append(params, "04")
+		}
+		if colors[0] != "" {
+			params = append(params, "3"+colors[0])
+		}
+		if colors[1] != "" {
+			params = append(params, "4"+colors[1])
+		}
+		if len(params) == 0 {
+			params = append(params, "0")
+		}
+		fileColors[key] = sgr(strings.Join(params, ";"))
+	}
+}
+
+// isColored reports whether key has a color which changes the output.
+func isColored(key string) bool {
+	c := fileColors[key]
+	return c != "" && c != "0" && c != "00"
+}
+
+func matchColorPattern(name string) (sgr, bool) {
+	for _, p := range colorPatterns {
+		pattern, n := p.pattern, name
+		if !p.caseSensitive {
+			pattern, n = strings.ToLower(pattern), strings.ToLower(n)
+		}
+		if strings.ContainsAny(pattern[1:], "*?[") {
+			if ok, _ := path.Match(pattern, n); ok {
+				return p.color, true
+			}
+		} else if strings.HasSuffix(n, pattern[1:]) {
+			return p.color, true
+		}
+	}
+	return "", false
+}
+
+// fileColor returns the color for the file at filePath with file info info,
+// and false if it should not be colored. info is nil for a missing symlink
+// target, brokenLink is set for a symlink whose target is missing. Like GNU
+// only the mode of symlink targets is used, so they aren't colored as having
+// capabilities or multiple hard links.
+func fileColor(filePath string, info os.FileInfo, brokenLink, target bool) (sgr, bool) {
+	if info == nil {
+		if isColored("mi") {
+			return fileColors["mi"], true
+		}
+		c, ok := fileColors["or"]
+		return c, ok
+	}
+
+	mode := info.Mode()
+	var key string
+	switch {
+	case IsDoor(info):
+		key = "do"
+	case mode.IsRegular():
+		key = "fi"
+		if mode&os.ModeSetuid != 0 && isColored("su") {
+			key = "su"
+		} else if mode&os.ModeSetgid != 0 && isColored("sg") {
+			key = "sg"
+		} else if !target && isColored("ca") && HasCapability(filePath) {
+			key = "ca"
+		} else if mode&0111 != 0 && isColored("ex") {
+			key = "ex"
+		} else if !target && isColored("mh") && GetLinks(info) > 1 {
+			key = "mh"
+		}
+	case mode.IsDir():
+		key = "di"
+		if mode&os.ModeSticky != 0 && mode&0002 != 0 && isColored("tw") {
+			key = "tw"
+		} else if mode&0002 != 0 && isColored("ow") {
+			key = "ow"
+		} else if mode&os.ModeSticky != 0 && isColored("st") {
+			key = "st"
+		}
+	case mode&os.ModeSymlink != 0:
+		key = "ln"
+		if brokenLink && (colorSymlinkAsTarget || isColored("or")) {
+			key = "or"
+		}
+	case mode&os.ModeNamedPipe != 0:
+		key = "pi"
+	case mode&os.ModeSocket != 0:
+		key = "so"
+	case mode&os.ModeCharDevice != 0:
+		key = "cd"
+	case mode&os.ModeDevice != 0:
+		key = "bd"
+	default:
+		key = "or"
+	}
+
+	if key == "fi" {
+		if c, ok := matchColorPattern(path.Base(filePath)); ok {
+			return c, true
+		}
+	}
+	c, ok := fileColors[key]
+	return c, ok
+}
+
+// entryColor returns the color for v, linkInfo is the file info of its
+// target if v is a symlink to an existing file.
+func entryColor(root string, v DisplayEntry, brokenLink bool, linkInfo os.FileInfo) (sgr, bool) {
+	info := v.FileInfo
+	if colorSymlinkAsTarget && linkInfo != nil {
+		info = linkInfo
+	}
+	return fileColor(root+v.path, info, brokenLink, false)
+}
+
+// putIndicator writes an escape sequence, before the first one the terminal
+// is reset in case it was left in a colored state, after making sure a
+// Windows console handles escape sequences.
+func putIndicator(s string) {
+	if !usedColor {
+		usedColor = true
+		if err := EnableEscapes(os.Stdout); err != nil {
+			log.Printf("can't enable escape sequences: %v", err)
+		}
+		endColor()
+	}
+	fmt.Fprint(output, s)
+}
+
+// endColor returns to the normal color after a colored name.
+func endColor() {
+	if colorEndSet {
+		putIndicator(colorEnd)
+	} else {
+		putIndicator(colorLeft + string(fileColors["rs"]) + colorRight)
+	}
+}
+
+// setNormalColor switches to the no color, if set, for text other than file
+// names.
+func setNormalColor() {
+	if isColored("no") {
+		putIndicator(colorLeft + string(fileColors["no"]) + colorRight)
+	}
+}
+
+// printColored prints name in color, if colored is set.
+func printColored(name string, color sgr, colored bool) {
+	if colored {
+		if isColored("no") {
+			// reset to not combine attributes with the no color
+			putIndicator(colorLeft + colorRight)
+		}
+		putIndicator(colorLeft + string(color) + colorRight)
+	}
+	fmt.Fprint(output, name)
+	if colored || isColored("no") {
+		endColor()
+	}
+}
+
+// finishColor restores the default color at exit, unless the wrappers are
+// the default ones and the reset after each name already did.
+func finishColor() {
+	if usedColor && (colorLeft != "\x1b[" || colorRight != "m") {
+		fmt.Fprint(output, colorLeft+colorRight)
+	}
+}
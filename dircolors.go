@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dircolorsKeywords maps the keywords of the dircolors database format to
+// LS_COLORS keys.
+var dircolorsKeywords = map[string]string{
+	"NORMAL":                "no",
+	"NORM":                  "no",
+	"FILE":                  "fi",
+	"RESET":                 "rs",
+	"DIR":                   "di",
+	"LNK":                   "ln",
+	"LINK":                  "ln",
+	"SYMLINK":               "ln",
+	"ORPHAN":                "or",
+	"MISSING":               "mi",
+	"FIFO":                  "pi",
+	"PIPE":                  "pi",
+	"SOCK":                  "so",
+	"BLK":                   "bd",
+	"BLOCK":                 "bd",
+	"CHR":                   "cd",
+	"CHAR":                  "cd",
+	"DOOR":                  "do",
+	"EXEC":                  "ex",
+	"LEFT":                  "lc",
+	"LEFTCODE":              "lc",
+	"RIGHT":                 "rc",
+	"RIGHTCODE":             "rc",
+	"END":                   "ec",
+	"ENDCODE":               "ec",
+	"SUID":                  "su",
+	"SETUID":                "su",
+	"SGID":                  "sg",
+	"SETGID":                "sg",
+	"STICKY":                "st",
+	"OTHER_WRITABLE":        "ow",
+	"OWR":                   "ow",
+	"STICKY_OTHER_WRITABLE": "tw",
+	"OWT":                   "tw",
+	"CAPABILITY":            "ca",
+	"MULTIHARDLINK":         "mh",
+	"CLRTOEOL":              "cl",
+}
+
+// colorKeyOrder is the order keys are printed by --print-colors, with a
+// description of the files each key colors.
+var colorKeyOrder = []struct {
+	key         string
+	description string
+}{
+	{"lc", "left code"},
+	{"rc", "right code"},
+	{"ec", "end code"},
+	{"rs", "reset"},
+	{"no", "normal text"},
+	{"fi", "regular file"},
+	{"di", "directory"},
+	{"ln", "symbolic link"},
+	{"mh", "file with multiple hard links"},
+	{"pi", "named pipe"},
+	{"so", "socket"},
+	{"do", "door"},
+	{"bd", "block device"},
+	{"cd", "character device"},
+	{"or", "orphaned symbolic link"},
+	{"mi", "missing file"},
+	{"su", "setuid file"},
+	{"sg", "setgid file"},
+	{"ca", "file with capabilities"},
+	{"tw", "sticky and other writable directory"},
+	{"ow", "other writable directory"},
+	{"st", "sticky directory"},
+	{"ex", "executable file"},
+}
+
+// dircolorsFile returns the path of the user's dircolors database,
+// $XDG_CONFIG_HOME/ls/dircolors or ~/.dircolors, or "" if there is none.
+func dircolorsFile() string {
+	home, _ := os.UserHomeDir()
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" && home != "" {
+		configDir = filepath.Join(home, ".config")
+	}
+	var candidates []string
+	if configDir != "" {
+		candidates = append(candidates, filepath.Join(configDir, "ls", "dircolors"))
+	}
+	if home != "" {
+		candidates = append(candidates, filepath.Join(home, ".dircolors"))
+	}
+	for _, fileName := range candidates {
+		if _, err := os.Stat(fileName); err == nil {
+			return fileName
+		}
+	}
+	return ""
+}
+
+// parseDircolors adds the entries of a dircolors(1) database to the color
+// settings. Entries following TERM or COLORTERM lines only apply if one of
+// the patterns of those lines matches the TERM or COLORTERM environment
+// variable, until the next TERM or COLORTERM line.
+func parseDircolors(fileName string, data string) {
+	term := os.Getenv("TERM")
+	if term == "" {
+		term = "none"
+	}
+	colorTerm := os.Getenv("COLORTERM")
+
+	const (
+		stateGlobal  int = iota
+		stateTermNo  int = iota
+		stateTermYes int = iota
+		// a TERM line matched, later TERM lines in the same block can't
+		// unmatch it
+		stateTermSure int = iota
+	)
+	state := stateGlobal
+
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		keyword, arg := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			keyword, arg = line[:i], line[i+1:]
+			if i := strings.IndexByte(arg, '#'); i >= 0 {
+				arg = arg[:i]
+			}
+			arg = strings.TrimSpace(arg)
+		}
+		if arg == "" {
+			log.Printf("%s:%d: missing value for %s", fileName, n+1, keyword)
+			continue
+		}
+
+		switch strings.ToUpper(keyword) {
+		case "TERM", "COLORTERM":
+			value := term
+			if strings.ToUpper(keyword) == "COLORTERM" {
+				value = colorTerm
+			}
+			if ok, _ := filepath.Match(arg, value); ok {
+				state = stateTermSure
+			} else if state != stateTermSure {
+				state = stateTermNo
+			}
+			continue
+		}
+		if state == stateTermSure {
+			state = stateTermYes
+		}
+		if state == stateTermNo {
+			continue
+		}
+
+		var key string
+		switch upper := strings.ToUpper(keyword); {
+		case keyword[0] == '.':
+			key = "*" + keyword
+		case keyword[0] == '*':
+			key = keyword
+		case upper == "OPTIONS" || upper == "COLOR" || upper == "EIGHTBIT":
+			// slackware options, ignored like GNU dircolors
+			continue
+		default:
+			var ok bool
+			if key, ok = dircolorsKeywords[upper]; !ok {
+				log.Printf("%s:%d: unrecognized keyword %s", fileName, n+1, keyword)
+				continue
+			}
+		}
+		if !setColorEntry(unescapeColor(key), unescapeColor(arg)) {
+			log.Printf("%s:%d: ignoring invalid entry %s %s", fileName, n+1, keyword, arg)
+		}
+	}
+}
+
+// escapeColor is the reverse of unescapeColor, escaping the characters which
+// can't appear literally in LS_COLORS.
+func escapeColor(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == 0x1b:
+			b.WriteString(`\e`)
+		case c == '\\' || c == '^' || c == ':' || c == '=':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c == 127:
+			fmt.Fprintf(&b, `\%03o`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// lsColorsString returns the current color settings in LS_COLORS format.
+func lsColorsString() string {
+	var entries []string
+	for _, k := range colorKeyOrder {
+		switch k.key {
+		case "lc":
+			if colorLeft != "\x1b[" {
+				entries = append(entries, "lc="+escapeColor(colorLeft))
+			}
+		case "rc":
+			if colorRight != "m" {
+				entries = append(entries, "rc="+escapeColor(colorRight))
+			}
+		case "ec":
+			if colorEndSet {
+				entries = append(entries, "ec="+escapeColor(colorEnd))
+			}
+		case "ln":
+			if colorSymlinkAsTarget {
+				entries = append(entries, "ln=target")
+				continue
+			}
+			fallthrough
+		default:
+			if c, ok := fileColors[k.key]; ok {
+				entries = append(entries, k.key+"="+string(c))
+			}
+		}
+	}
+	// colorPatterns are newest first
+	for i := len(colorPatterns) - 1; i >= 0; i-- {
+		p := colorPatterns[i]
+		entries = append(entries, escapeColor(p.pattern)+"="+string(p.color))
+	}
+	return strings.Join(entries, ":")
+}
+
+// printColors prints the LS_COLORS value for the current color settings, as
+// a shell command, followed by a table showing each entry in its color.
+func printColors(colored bool) {
+	lsColors := lsColorsString()
+	fmt.Fprintf(output, "LS_COLORS='%s'; export LS_COLORS\n\n", strings.Replace(lsColors, "'", `'\''`, -1))
+
+	type row struct {
+		key, color, description string
+	}
+	var rows []row
+	for _, k := range colorKeyOrder {
+		if k.key == "lc" || k.key == "rc" || k.key == "ec" {
+			continue
+		}
+		if k.key == "ln" && colorSymlinkAsTarget {
+			rows = append(rows, row{k.key, "target", k.description})
+		} else if c, ok := fileColors[k.key]; ok {
+			rows = append(rows, row{k.key, string(c), k.description})
+		}
+	}
+	for i := len(colorPatterns) - 1; i >= 0; i-- {
+		p := colorPatterns[i]
+		rows = append(rows, row{p.pattern, string(p.color), "file name matching " + p.pattern})
+	}
+
+	keyWidth, colorWidth := 0, 0
+	for _, r := range rows {
+		if w := displayWidth(r.key); w > keyWidth {
+			keyWidth = w
+		}
+		if len(r.color) > colorWidth {
+			colorWidth = len(r.color)
+		}
+	}
+	for _, r := range rows {
+		if colored && r.color != "target" {
+			printColored(r.key, sgr(r.color), true)
+		} else {
+			fmt.Fprint(output, r.key)
+		}
+		fmt.Fprintf(output, "%s  %-*s  %s\n", strings.Repeat(" ", keyWidth-displayWidth(r.key)), colorWidth, r.color, r.description)
+	}
+	if colored {
+		finishColor()
+	}
+}
@@ -4,9 +4,10 @@ go 1.17
 
 require (
 	github.com/bradfitz/slice v0.0.0-20180809154707-2b758aa73013
-	github.com/daviddengcn/go-colortext v1.0.0
 	github.com/dustin/go-humanize v1.0.0
 	github.com/timob/sindex v0.0.0-20201206080312-1eedde862709
+	golang.org/x/sys v0.5.0
+	golang.org/x/text v0.7.0
 )
 
 require go4.org v0.0.0-20201209231011-d4a079459e60 // indirect
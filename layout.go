@@ -0,0 +1,174 @@
+package main
+
+import "fmt"
+
+// columnSeparation is the minimum number of spaces between grid columns
+const columnSeparation = 2
+
+// minColumnWidth is the width of the narrowest possible column, a one
+// character name and separation
+const minColumnWidth = 1 + columnSeparation
+
+// columnLayout is a candidate grid layout, it is valid while its line length
+// fits within width.
+type columnLayout struct {
+	valid     bool
+	lineLen   int
+	colWidths []int
+}
+
+// calculateColumns finds the layout with the most columns which fits all the
+// entry widths within width, in a single pass over the entries for every
+// candidate column count, like GNU ls. The column widths include separation,
+// except for the last column.
+func calculateColumns(widths []int, byColumns bool) (int, []int) {
+	n := len(widths)
+	// like GNU, round up so a last narrower column is considered, a width of
+	// 0 is handled by displayGrid
+	maxCols := width / minColumnWidth
+	if width%minColumnWidth != 0 {
+		maxCols++
+	}
+	if maxCols > n {
+		maxCols = n
+	}
+	if maxCols < 1 {
+		maxCols = 1
+	}
+
+	layouts := make([]columnLayout, maxCols)
+	for i := range layouts {
+		layouts[i].valid = true
+		layouts[i].lineLen = (i + 1) * minColumnWidth
+		layouts[i].colWidths = make([]int, i+1)
+		for j := range layouts[i].colWidths {
+			layouts[i].colWidths[j] = minColumnWidth
+		}
+	}
+
+	for fileNo, w := range widths {
+		for i := range layouts {
+			layout := &layouts[i]
+			if !layout.valid {
+				continue
+			}
+			cols := i + 1
+			var idx int
+			if byColumns {
+				rows := (n + i) / cols
+				idx = fileNo / rows
+			} else {
+				idx = fileNo % cols
+			}
+			realWidth := w
+			if idx != i {
+				realWidth += columnSeparation
+			}
+			if layout.colWidths[idx] < realWidth {
+				layout.lineLen += realWidth - layout.colWidths[idx]
+				layout.colWidths[idx] = realWidth
+				layout.valid = layout.lineLen < width
+			}
+		}
+	}
+
+	cols := maxCols
+	for cols > 1 && !layouts[cols-1].valid {
+		cols--
+	}
+	return cols, layouts[cols-1].colWidths
+}
+
+// wideColumns lays out entries in columns of a fixed height for -W, so the
+// listing can be scrolled sideways in a pager.
+func wideColumns(widths []int, rows int) (int, []int) {
+	cols := (len(widths) + rows - 1) / rows
+	colWidths := make([]int, cols)
+	for i, w := range widths {
+		col := i / rows
+		if col != cols-1 {
+			w += columnSeparation
+		}
+		if w > colWidths[col] {
+			colWidths[col] = w
+		}
+	}
+	return cols, colWidths
+}
+
+// displayGrid lists selected in one of the multi-column formats, or one entry
+// per line.
+func displayGrid(selected []DisplayEntry, root string, blockWidth int) {
+	if format == formatOnePerLine {
+		for _, v := range selected {
+			printEntry(v, root, blockWidth)
+			fmt.Fprint(output, eol)
+		}
+		return
+	}
+
+	byColumns := format == formatVertical
+	if width <= 0 && !(wide && byColumns) {
+		// like GNU, without a line width limit all entries go on one line
+		for i, v := range selected {
+			if i != 0 {
+				fmt.Fprint(output, "  ")
+			}
+			printEntry(v, root, blockWidth)
+		}
+		fmt.Fprint(output, eol)
+		return
+	}
+
+	widths := make([]int, len(selected))
+	for i, v := range selected {
+		widths[i] = entryWidth(v, blockWidth)
+	}
+
+	var cols int
+	var colWidths []int
+	if wide && byColumns {
+		rows := height - 2
+		if rows < 1 {
+			rows = 1
+		}
+		cols, colWidths = wideColumns(widths, rows)
+	} else {
+		cols, colWidths = calculateColumns(widths, byColumns)
+	}
+
+	if byColumns {
+		rows := (len(selected) + cols - 1) / cols
+		for row := 0; row < rows; row++ {
+			pos := 0
+			for col, fileNo := 0, row; ; col++ {
+				v := selected[fileNo]
+				printEntry(v, root, blockWidth)
+				fileNo += rows
+				if fileNo >= len(selected) {
+					break
+				}
+				indent(pos+widths[fileNo-rows], pos+colWidths[col])
+				pos += colWidths[col]
+			}
+			fmt.Fprint(output, eol)
+		}
+		return
+	}
+
+	pos := 0
+	for fileNo, v := range selected {
+		col := fileNo % cols
+		if col == 0 {
+			if fileNo != 0 {
+				fmt.Fprint(output, eol)
+			}
+			pos = 0
+		} else {
+			indent(pos+widths[fileNo-1], pos+colWidths[col-1])
+			pos += colWidths[col-1]
+		}
+		printEntry(v, root, blockWidth)
+	}
+	fmt.Fprint(output, eol)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixtureFile is the file info of a regular file in a fixture tree
+type fixtureFile string
+
+func (f fixtureFile) Name() string       { return string(f) }
+func (f fixtureFile) Size() int64        { return 0 }
+func (f fixtureFile) Mode() os.FileMode  { return 0644 }
+func (f fixtureFile) ModTime() time.Time { return time.Time{} }
+func (f fixtureFile) IsDir() bool        { return false }
+func (f fixtureFile) Sys() interface{}   { return nil }
+
+// TestDisplayGrid compares the -C and -x layouts of the fixture trees in
+// testdata/layout with the output of GNU ls. Each fixture has the sorted file
+// names in names, and the GNU output for ls -FORMAT --width=WIDTH in
+// FORMAT-WIDTH.
+func TestDisplayGrid(t *testing.T) {
+	goldens, err := filepath.Glob("testdata/layout/*/[Cx]-*")
+	if err != nil || len(goldens) == 0 {
+		t.Fatalf("no fixtures found: %v", err)
+	}
+	defer func(f, w, ts int) {
+		format, width, tabSize = f, w, ts
+	}(format, width, tabSize)
+
+	for _, golden := range goldens {
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(golden), "names"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var selected []DisplayEntry
+		for _, name := range strings.Fields(string(data)) {
+			selected = append(selected, DisplayEntry{path: name, name: name, FileInfo: fixtureFile(name)})
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		formatName := strings.SplitN(filepath.Base(golden), "-", 2)
+		if width, err = strconv.Atoi(formatName[1]); err != nil {
+			t.Fatalf("%s: invalid width: %v", golden, err)
+		}
+		format = formatVertical
+		if formatName[0] == "x" {
+			format = formatHorizontal
+		}
+		// like main, an unlimited width is padded with spaces only
+		tabSize = 8
+		if width <= 0 {
+			tabSize = 0
+		}
+
+		var buf bytes.Buffer
+		output = bufio.NewWriter(&buf)
+		displayGrid(selected, "", 0)
+		output.Flush()
+		if got := buf.String(); got != string(want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", golden, got, want)
+		}
+	}
+}
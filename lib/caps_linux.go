@@ -0,0 +1,9 @@
+package ls
+
+import "golang.org/x/sys/unix"
+
+// HasCapability reports whether the file at path has file capabilities set.
+func HasCapability(path string) bool {
+	n, err := unix.Lgetxattr(path, "security.capability", nil)
+	return err == nil && n > 0
+}
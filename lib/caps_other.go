@@ -0,0 +1,7 @@
+// +build !linux
+
+package ls
+
+func HasCapability(path string) bool {
+	return false
+}
@@ -0,0 +1,82 @@
+package ls
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collator orders strings by the collation rules of a locale, in the C and
+// POSIX locales strings are ordered by byte value like strcmp.
+type Collator struct {
+	c   *collate.Collator
+	buf collate.Buffer
+}
+
+// Locale returns the locale used for collation, from LC_ALL, LC_COLLATE or
+// LANG.
+func Locale() string {
+	for _, name := range []string{"LC_ALL", "LC_COLLATE", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return "C"
+}
+
+// NewCollator returns a Collator for a POSIX locale name such as
+// en_US.UTF-8. Unknown locales collate like C.
+func NewCollator(locale string) *Collator {
+	// strip the codeset and modifier, en_US.UTF-8@euro is en_US
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return &Collator{}
+	}
+	tag, err := language.Parse(strings.Replace(locale, "_", "-", -1))
+	if err != nil {
+		return &Collator{}
+	}
+	return &Collator{c: collate.New(tag)}
+}
+
+// Compare returns -1, 0 or 1 as a collates before, equal to or after b.
+func (c *Collator) Compare(a, b string) int {
+	if c.c != nil {
+		if r := c.c.CompareString(a, b); r != 0 {
+			return r
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// Key returns the collation key of s, keys compared with bytes.Compare order
+// strings as Compare does except that strings which collate equally give
+// equal keys. The key is valid until the next call to Reset.
+func (c *Collator) Key(s string) []byte {
+	if c.c == nil {
+		return []byte(s)
+	}
+	return c.c.KeyFromString(&c.buf, s)
+}
+
+// Reset frees the memory held by the keys returned by Key.
+func (c *Collator) Reset() {
+	c.buf.Reset()
+}
+
+var defaultCollator *Collator
+var defaultCollatorOnce sync.Once
+
+// Strcoll compares s1 and s2 in the collation order of the locale from the
+// environment, like the C function strcoll.
+func Strcoll(s1, s2 string) int {
+	defaultCollatorOnce.Do(func() {
+		defaultCollator = NewCollator(Locale())
+	})
+	return defaultCollator.Compare(s1, s2)
+}
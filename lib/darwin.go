@@ -1,11 +0,0 @@
-//+build darwin
-
-package ls
-
-import (
-	"syscall"
-)
-
-func init() {
-	ioctlReadTermiosMagic = syscall.TIOCGETA
-}
@@ -0,0 +1,38 @@
+package ls
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var deviceDrivers map[string]string
+
+// DeviceDriver returns the name of the driver registered for the major
+// device number as listed in /proc/devices, or "" if it is unknown.
+func DeviceDriver(major uint32, char bool) string {
+	if deviceDrivers == nil {
+		deviceDrivers = make(map[string]string)
+		if file, err := os.Open("/proc/devices"); err == nil {
+			section := ""
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if strings.HasPrefix(line, "Character devices:") {
+					section = "c"
+				} else if strings.HasPrefix(line, "Block devices:") {
+					section = "b"
+				} else if fields := strings.Fields(line); len(fields) == 2 {
+					deviceDrivers[section+fields[0]] = fields[1]
+				}
+			}
+			file.Close()
+		}
+	}
+	section := "b"
+	if char {
+		section = "c"
+	}
+	return deviceDrivers[section+strconv.FormatUint(uint64(major), 10)]
+}
@@ -0,0 +1,7 @@
+// +build !linux
+
+package ls
+
+func DeviceDriver(major uint32, char bool) string {
+	return ""
+}
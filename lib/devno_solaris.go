@@ -0,0 +1,5 @@
+package ls
+
+func deviceNumbers(rdev uint64) (major, minor uint32) {
+	return uint32(rdev >> 32), uint32(rdev & 0xffffffff)
+}
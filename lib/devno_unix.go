@@ -0,0 +1,9 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package ls
+
+import "golang.org/x/sys/unix"
+
+func deviceNumbers(rdev uint64) (major, minor uint32) {
+	return unix.Major(rdev), unix.Minor(rdev)
+}
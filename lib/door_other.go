@@ -0,0 +1,9 @@
+// +build !solaris
+
+package ls
+
+import "os"
+
+func IsDoor(info os.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,15 @@
+package ls
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// IsDoor reports whether the file is a Solaris door, which os.FileMode has
+// no type bit for.
+func IsDoor(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stat.Mode&unix.S_IFMT == unix.S_IFDOOR
+}
@@ -0,0 +1,125 @@
+package ls
+
+// Filevercmp compares file names a and b as versions, like GNU filevercmp,
+// returning a negative number, zero or a positive number when a sorts
+// before, the same as or after b. Runs of digits are compared numerically, so
+// build-2 sorts before build-10, and file suffixes such as .tar.gz are only
+// compared when the rest of the names are equal. Empty names sort first, then
+// ".", "..", then other names starting with '.'.
+func Filevercmp(a, b string) int {
+	aempty, bempty := a == "", b == ""
+	if aempty || bempty {
+		return boolInt(bempty) - boolInt(aempty)
+	}
+
+	if a[0] == '.' {
+		if b[0] != '.' {
+			return -1
+		}
+		adot, bdot := a == ".", b == "."
+		if adot || bdot {
+			return boolInt(bdot) - boolInt(adot)
+		}
+		adotdot, bdotdot := a == "..", b == ".."
+		if adotdot || bdotdot {
+			return boolInt(bdotdot) - boolInt(adotdot)
+		}
+	} else if b[0] == '.' {
+		return 1
+	}
+
+	aprefix, bprefix := filePrefixLen(a), filePrefixLen(b)
+	result := verrevcmp(a[:aprefix], b[:bprefix])
+	if result != 0 || aprefix == len(a) && bprefix == len(b) {
+		return result
+	}
+	return verrevcmp(a, b)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// filePrefixLen returns the length of s without its longest suffix matching
+// (\.[A-Za-z~][A-Za-z0-9~]*)*$, a file suffix like ".tar.gz" or "~". The first
+// byte is never part of the suffix.
+func filePrefixLen(s string) int {
+	prefixLen := 0
+	for i := 0; i < len(s); {
+		i++
+		prefixLen = i
+		for i+1 < len(s) && s[i] == '.' && (isAlpha(s[i+1]) || s[i+1] == '~') {
+			for i += 2; i < len(s) && (isAlpha(s[i]) || isDigit(s[i]) || s[i] == '~'); i++ {
+			}
+		}
+	}
+	return prefixLen
+}
+
+// order returns the sort weight of s[pos] outside digit runs, the end of the
+// string sorts before everything but '~', and letters before other bytes.
+func order(s string, pos int) int {
+	if pos >= len(s) {
+		return -1
+	}
+	c := s[pos]
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -2
+	}
+	return int(c) + 256
+}
+
+// verrevcmp is the Debian version comparison algorithm.
+func verrevcmp(a, b string) int {
+	apos, bpos := 0, 0
+	for apos < len(a) || bpos < len(b) {
+		firstDiff := 0
+		for apos < len(a) && !isDigit(a[apos]) || bpos < len(b) && !isDigit(b[bpos]) {
+			ac, bc := order(a, apos), order(b, bpos)
+			if ac != bc {
+				return ac - bc
+			}
+			apos++
+			bpos++
+		}
+		for apos < len(a) && a[apos] == '0' {
+			apos++
+		}
+		for bpos < len(b) && b[bpos] == '0' {
+			bpos++
+		}
+		for apos < len(a) && bpos < len(b) && isDigit(a[apos]) && isDigit(b[bpos]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[apos]) - int(b[bpos])
+			}
+			apos++
+			bpos++
+		}
+		if apos < len(a) && isDigit(a[apos]) {
+			return 1
+		}
+		if bpos < len(b) && isDigit(b[bpos]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return firstDiff
+		}
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package ls
+
+import "testing"
+
+// filevercmpExamples are in increasing order, from the gnulib filevercmp
+// tests with build-2 and build-10 added.
+var filevercmpExamples = []string{
+	"",
+	".",
+	"..",
+	".0",
+	".9",
+	".A",
+	".Z",
+	".a~",
+	".a",
+	".b~",
+	".b",
+	".z",
+	".zz~",
+	".zz",
+	".zz.~1~",
+	".zz.0",
+	".\x01",
+	".\x01.txt",
+	".\x01x",
+	".\x01x\x01",
+	".\x01.0",
+	"0",
+	"9",
+	"A",
+	"Z",
+	"a~",
+	"a",
+	"a.b~",
+	"a.b",
+	"a.bc~",
+	"a.bc",
+	"a+",
+	"a.",
+	"a.0.txt",
+	"a..a",
+	"a.1",
+	"a.+",
+	"a.+b",
+	"b~",
+	"b",
+	"build-2",
+	"build-10",
+	"gcc-c++-10.fc9.tar.gz",
+	"gcc-c++-10.8.12-0.7rc2.fc9.tar.bz2",
+	"glibc-2-0.1.beta1.fc10.rpm",
+	"glibc-common-5-0.2.beta2.fc9.ebuild",
+	"glibc-common-5-0.2b.deb",
+	"glibc-common-11b.ebuild",
+	"glibc-common-11-0.6rc2.ebuild",
+	"libstdc++-0.5.8.11-0.7rc2.fc10.tar.gz",
+	"libstdc++-4a.fc8.tar.gz",
+	"libstdc++-4.10.4.20040204svn.rpm",
+	"libstdc++-devel-3.fc8.ebuild",
+	"libstdc++-devel-3a.fc9.tar.gz",
+	"libstdc++-devel-8.fc8.deb",
+	"libstdc++-devel-8.6.2-0.4b.fc8",
+	"nss_ldap-1-0.2b.fc9.tar.bz2",
+	"nss_ldap-1-0.6rc2.fc8.tar.gz",
+	"nss_ldap-1.0-0.1a.tar.gz",
+	"nss_ldap-10beta1.fc8.tar.gz",
+	"nss_ldap-10.11.8.6.20040204cvs.fc10.ebuild",
+	"z",
+	"zz~",
+	"zz",
+	"zz.~1~",
+	"zz.0",
+	"zz.0.txt",
+	"\x01",
+	"\x01.txt",
+	"\x01x",
+	"\x01x\x01",
+	"\x01.0",
+	"#\x01.b#",
+	"#.b#",
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	} else if n > 0 {
+		return 1
+	}
+	return 0
+}
+
+func TestFilevercmpOrder(t *testing.T) {
+	for i, a := range filevercmpExamples {
+		for j, b := range filevercmpExamples {
+			if got, want := sign(Filevercmp(a, b)), sign(i-j); got != want {
+				t.Errorf("Filevercmp(%q, %q) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestFilevercmpEqual(t *testing.T) {
+	// leading zeros are ignored, callers break these ties by name
+	for _, tc := range [][2]string{
+		{"a0", "a0000"},
+		{"a01", "a1"},
+		{"a09", "a9"},
+		{"a.", "a.0"},
+		{"a", "a0"},
+	} {
+		if c := Filevercmp(tc[0], tc[1]); c != 0 {
+			t.Errorf("Filevercmp(%q, %q) = %d, want 0", tc[0], tc[1], c)
+		}
+	}
+}
+
+func TestFilevercmpLess(t *testing.T) {
+	for _, tc := range [][2]string{
+		{"build-2", "build-10"},
+		{"foo-2.tar.gz", "foo-10.tar.gz"},
+		{"file-1.9.tar.gz", "file-1.10.tar.gz"},
+		{"file-1.9.tar.gz", "file-1.9.1.tar.gz"},
+		{"007", "8"},
+		{"v1.0~rc1", "v1.0"},
+	} {
+		if c := Filevercmp(tc[0], tc[1]); c >= 0 {
+			t.Errorf("Filevercmp(%q, %q) = %d, want < 0", tc[0], tc[1], c)
+		}
+		if c := Filevercmp(tc[1], tc[0]); c <= 0 {
+			t.Errorf("Filevercmp(%q, %q) = %d, want > 0", tc[1], tc[0], c)
+		}
+	}
+}
@@ -1,10 +1,11 @@
-// +build !cgo,!windows,!plan9 android
+// +build android !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
 
 package ls
 
 import (
 	"errors"
 	"os"
+	"time"
 )
 
 type LongInfo struct {
@@ -13,7 +14,12 @@ type LongInfo struct {
 	Ino					uint64
 }
 
-func GetTermSize() (int, int, error) {
+type FileTimes struct {
+	Access, Change, Birth time.Time
+	HasBirth              bool
+}
+
+func GetTermSize(f *os.File) (int, int, error) {
 	return 0, 0, errors.New("not implemented")
 }
 
@@ -21,6 +27,41 @@ func GetLongInfo(info os.FileInfo) *LongInfo {
 	return &LongInfo{"unknown", "unknown", 1, 1}
 }
 
-func IsTerminal(fd int) bool {
-	return true
+// EnableEscapes does nothing, terminals are assumed to handle ANSI escape
+// sequences.
+func EnableEscapes(f *os.File) error {
+	return nil
+}
+
+func OpenTerminal() (*os.File, error) {
+	return nil, errors.New("not implemented")
+}
+
+func GetFileTimes(path string, info os.FileInfo) *FileTimes {
+	return &FileTimes{info.ModTime(), info.ModTime(), time.Time{}, false}
+}
+
+func GetBlocks(info os.FileInfo) int64 {
+	return (info.Size() + 511) / 512
+}
+
+func GetDeviceNumbers(info os.FileInfo) (major, minor uint32) {
+	return 0, 0
+}
+
+func GetDevice(info os.FileInfo) uint64 {
+	return 0
+}
+
+func GetInode(info os.FileInfo) uint64 {
+	return 0
+}
+
+// GetFileId returns false, there are no file ids to tell files apart.
+func GetFileId(path string, info os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
+
+func GetLinks(info os.FileInfo) int {
+	return 1
 }
@@ -0,0 +1,17 @@
+package ls
+
+import "errors"
+
+// ResolveNames controls whether GetLongInfo looks up user and group names,
+// when false the numeric ids are returned without any name service lookups.
+var ResolveNames = true
+
+// NSSFallback controls whether builds without cgo look up user and group ids
+// which are not in /etc/passwd or /etc/group with getent(1), to reach name
+// services such as LDAP. Builds with cgo always use the C library. It is
+// cleared by --nss-fallback=no.
+var NSSFallback = true
+
+// errUnknownSize is returned by GetTermSize for terminals which report a
+// width of 0
+var errUnknownSize = errors.New("terminal size unknown")
@@ -0,0 +1,98 @@
+// +build darwin dragonfly freebsd !android,linux netbsd openbsd solaris
+// +build cgo
+
+package ls
+
+import (
+	"fmt"
+	"os/user"
+	"runtime"
+	"strconv"
+	"syscall"
+)
+
+/*
+#include <unistd.h>
+#include <sys/types.h>
+#include <pwd.h>
+#include <grp.h>
+#include <stdlib.h>
+#include <string.h>
+
+static int mygetgrgid_r(int gid, struct group *grp,
+	char *buf, size_t buflen, struct group **result) {
+	return getgrgid_r(gid, grp, buf, buflen, result);
+}
+*/
+import "C"
+
+// taken from os/user/lookup_unix.go
+func groupNameOSLookup(gid int) (string, error) {
+	var grp C.struct_group
+	var result *C.struct_group
+
+	var bufSize C.long
+	if runtime.GOOS == "dragonfly" || runtime.GOOS == "freebsd" {
+		// DragonFly and FreeBSD do not have _SC_GETPW_R_SIZE_MAX
+		// and just return -1.  So just use the same
+		// size that Linux returns.
+		bufSize = 1024
+	} else {
+		bufSize = C.sysconf(C._SC_GETGR_R_SIZE_MAX)
+		if bufSize <= 0 || bufSize > 1<<20 {
+			return "", fmt.Errorf("user: unreasonable _SC_GETGR_R_SIZE_MAX of %d", bufSize)
+		}
+	}
+	buf := C.malloc(C.size_t(bufSize))
+	defer C.free(buf)
+	var rv C.int
+	// mygetgrgid_r is a wrapper around getgrgid_r to
+	// to avoid using gid_t because C.gid_t(uid) for
+	// unknown reasons doesn't work on linux.
+	rv = C.mygetgrgid_r(C.int(gid),
+		&grp,
+		(*C.char)(buf),
+		C.size_t(bufSize),
+		&result)
+	if rv != 0 {
+		return "", fmt.Errorf("ls: lookup group failed id %d: %s", gid, syscall.Errno(rv))
+	}
+	if result == nil {
+		return "", UnknownGroupIdError(gid)
+	}
+	return C.GoString(grp.gr_name), nil
+}
+
+var groupLookupCache = make(map[string]string)
+
+func groupLookup(id string) (string, error) {
+	if v, ok := groupLookupCache[id]; ok {
+		return v, nil
+	} else {
+		i, e := strconv.Atoi(id)
+		if e != nil {
+			return "", e
+		}
+		g, err := groupNameOSLookup(i)
+		if err == nil {
+			groupLookupCache[id] = g
+			return g, nil
+		}
+		return "", err
+	}
+}
+
+var userLookupCache = make(map[string]string)
+
+func userLookUp(id string) (string, error) {
+	if v, ok := userLookupCache[id]; ok {
+		return v, nil
+	} else {
+		u, err := user.LookupId(id)
+		if err == nil {
+			userLookupCache[id] = u.Username
+			return u.Username, nil
+		}
+		return "", err
+	}
+}
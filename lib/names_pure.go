@@ -0,0 +1,94 @@
+// +build darwin dragonfly freebsd !android,linux netbsd openbsd solaris
+// +build !cgo
+
+package ls
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// idNames maps numeric ids to names, read once from /etc/passwd or
+// /etc/group
+type idNames struct {
+	once  sync.Once
+	names map[string]string
+}
+
+var passwdNames, groupNames idNames
+
+// lookup returns the name of id from fileName, or if it isn't listed there
+// from the getent database when NSSFallback is set. Lookups through getent
+// are cached, including failures.
+func (n *idNames) lookup(fileName, database, id string) (string, bool) {
+	n.once.Do(func() {
+		n.names = readIdFile(fileName)
+	})
+	if name, ok := n.names[id]; ok {
+		return name, name != ""
+	}
+	if !NSSFallback {
+		return "", false
+	}
+	name := getent(database, id)
+	n.names[id] = name
+	return name, name != ""
+}
+
+// readIdFile reads the name and id fields of a passwd or group format file,
+// name:password:id:...
+func readIdFile(fileName string) map[string]string {
+	names := make(map[string]string)
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return names
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, ":", 4)
+		if len(fields) < 3 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// skip NIS compat entries such as +user and -@netgroup
+		if strings.HasPrefix(fields[0], "+") || strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+		if _, ok := names[fields[2]]; !ok {
+			names[fields[2]] = fields[0]
+		}
+	}
+	return names
+}
+
+// getent looks up id with getent(1), which goes through NSS, returning "" if
+// it is not found or getent is not available.
+func getent(database, id string) string {
+	out, err := exec.Command("getent", database, id).Output()
+	if err != nil {
+		return ""
+	}
+	fields := strings.SplitN(string(out), ":", 4)
+	if len(fields) < 3 || fields[2] != id {
+		return ""
+	}
+	return fields[0]
+}
+
+func userLookUp(id string) (string, error) {
+	if name, ok := passwdNames.lookup("/etc/passwd", "passwd", id); ok {
+		return name, nil
+	}
+	uid, _ := strconv.Atoi(id)
+	return "", user.UnknownUserIdError(uid)
+}
+
+func groupLookup(id string) (string, error) {
+	if name, ok := groupNames.lookup("/etc/group", "group", id); ok {
+		return name, nil
+	}
+	gid, _ := strconv.Atoi(id)
+	return "", UnknownGroupIdError(gid)
+}
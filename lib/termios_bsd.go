@@ -0,0 +1,7 @@
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package ls
+
+import "golang.org/x/sys/unix"
+
+const ioctlReadTermios = unix.TIOCGETA
@@ -0,0 +1,7 @@
+// +build linux solaris
+
+package ls
+
+import "golang.org/x/sys/unix"
+
+const ioctlReadTermios = unix.TCGETS
@@ -0,0 +1,19 @@
+// +build darwin freebsd netbsd
+
+package ls
+
+import (
+	"syscall"
+	"time"
+)
+
+func statTimes(stat *syscall.Stat_t) (atime, ctime time.Time) {
+	return time.Unix(stat.Atimespec.Unix()), time.Unix(stat.Ctimespec.Unix())
+}
+
+func birthTime(path string, stat *syscall.Stat_t) (time.Time, bool) {
+	if stat.Birthtimespec.Sec <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(stat.Birthtimespec.Unix()), true
+}
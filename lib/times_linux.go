@@ -0,0 +1,30 @@
+package ls
+
+import (
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func statTimes(stat *syscall.Stat_t) (atime, ctime time.Time) {
+	return time.Unix(stat.Atim.Unix()), time.Unix(stat.Ctim.Unix())
+}
+
+// birthTime uses statx, which only reports a birth time if both the kernel
+// and the file system support it. Symlinks are only followed if stat is not
+// for a symlink, ie. it was dereferenced.
+func birthTime(path string, stat *syscall.Stat_t) (time.Time, bool) {
+	var stx unix.Statx_t
+	flags := 0
+	if stat.Mode&syscall.S_IFMT == syscall.S_IFLNK {
+		flags = unix.AT_SYMLINK_NOFOLLOW
+	}
+	if err := unix.Statx(unix.AT_FDCWD, path, flags, unix.STATX_BTIME, &stx); err != nil {
+		return time.Time{}, false
+	}
+	if stx.Mask&unix.STATX_BTIME == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), true
+}
@@ -0,0 +1,16 @@
+// +build dragonfly openbsd solaris
+
+package ls
+
+import (
+	"syscall"
+	"time"
+)
+
+func statTimes(stat *syscall.Stat_t) (atime, ctime time.Time) {
+	return time.Unix(stat.Atim.Unix()), time.Unix(stat.Ctim.Unix())
+}
+
+func birthTime(path string, stat *syscall.Stat_t) (time.Time, bool) {
+	return time.Time{}, false
+}
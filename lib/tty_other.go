@@ -0,0 +1,11 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows,!plan9
+
+package ls
+
+import "os"
+
+// IsTerminal returns false, without a way to ask whether f is a terminal
+// output is treated as going to a file or pipe.
+func IsTerminal(f *os.File) bool {
+	return false
+}
@@ -0,0 +1,19 @@
+// +build plan9
+
+package ls
+
+import (
+	"os"
+	"strings"
+	"syscall"
+)
+
+// IsTerminal reports whether f refers to the console, /dev/cons, possibly
+// imported from another machine as /mnt/term/dev/cons.
+func IsTerminal(f *os.File) bool {
+	name, err := syscall.Fd2path(int(f.Fd()))
+	if err != nil {
+		return false
+	}
+	return name == "#c/cons" || strings.HasSuffix(name, "/dev/cons")
+}
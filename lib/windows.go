@@ -3,9 +3,12 @@
 package ls
 
 import (
-	"errors"
 	"os"
 	"os/user"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
 )
 
 type LongInfo struct {
@@ -14,8 +17,24 @@ type LongInfo struct {
 	Ino					uint64	
 }
 
-func GetTermSize() (int, int, error) {
-	return 0, 0, errors.New("not implemented")
+type FileTimes struct {
+	Access, Change, Birth time.Time
+	HasBirth              bool
+}
+
+// GetTermSize returns the width and height of the console window f refers
+// to.
+func GetTermSize(f *os.File) (int, int, error) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(f.Fd()), &info); err != nil {
+		return -1, -1, err
+	}
+	w := int(info.Window.Right - info.Window.Left + 1)
+	h := int(info.Window.Bottom - info.Window.Top + 1)
+	if w <= 0 {
+		return -1, -1, errUnknownSize
+	}
+	return w, h, nil
 }
 
 var userName, groupName string
@@ -37,16 +56,81 @@ func GetLongInfo(info os.FileInfo) *LongInfo {
 	return &LongInfo{userName, groupName, 1, 1}
 }
 
-func IsTerminal(fd int) bool {
-	return true
+// IsTerminal reports whether f refers to a console.
+func IsTerminal(f *os.File) bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(f.Fd()), &mode) == nil
+}
+
+// EnableEscapes turns on processing of ANSI escape sequences by the console f
+// refers to, if it is a console.
+func EnableEscapes(f *os.File) error {
+	h := windows.Handle(f.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(h, &mode); err != nil {
+		return nil
+	}
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return nil
+	}
+	return windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+}
+
+// OpenTerminal opens the console of the process.
+func OpenTerminal() (*os.File, error) {
+	return os.OpenFile("CONOUT$", os.O_RDWR, 0)
 }
 
-func Strcoll(s1, s2 string) int {
-	if s1 > s2 {
-		return 1
-	} else if s1 < s2 {
-		return -1
-	} else {
-		return 0
+func GetFileTimes(path string, info os.FileInfo) *FileTimes {
+	if attr, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return &FileTimes{
+			time.Unix(0, attr.LastAccessTime.Nanoseconds()),
+			info.ModTime(),
+			time.Unix(0, attr.CreationTime.Nanoseconds()),
+			true,
+		}
 	}
+	return &FileTimes{info.ModTime(), info.ModTime(), time.Time{}, false}
+}
+
+func GetBlocks(info os.FileInfo) int64 {
+	return (info.Size() + 511) / 512
+}
+
+func GetDeviceNumbers(info os.FileInfo) (major, minor uint32) {
+	return 0, 0
+}
+
+func GetDevice(info os.FileInfo) uint64 {
+	return 0
+}
+
+func GetInode(info os.FileInfo) uint64 {
+	return 0
+}
+
+// GetFileId returns the volume serial number and file index which identify
+// the file at path, following reparse points, ok is false if the file can't be
+// opened.
+func GetFileId(path string, info os.FileInfo) (dev, ino uint64, ok bool) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	// FILE_FLAG_BACKUP_SEMANTICS is needed to open directories
+	h, err := windows.CreateFile(name, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer windows.CloseHandle(h)
+	var d windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(h, &d); err != nil {
+		return 0, 0, false
+	}
+	return uint64(d.VolumeSerialNumber), uint64(d.FileIndexHigh)<<32 | uint64(d.FileIndexLow), true
+}
+
+func GetLinks(info os.FileInfo) int {
+	return 1
 }
@@ -1,9 +1,8 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
-	"github.com/bradfitz/slice"
-	ct "github.com/daviddengcn/go-colortext"
 	. "github.com/timob/ls/lib"
 	"github.com/timob/sindex"
 	"log"
@@ -14,12 +13,25 @@ import (
 	"time"
 	"github.com/dustin/go-humanize"
 	"os/exec"
-	"io"
 )
 
 type DisplayEntry struct {
 	path string
 	os.FileInfo
+	// name is path quoted for display
+	name string
+	// fileTime is the time selected by timeType, hasFileTime is false if
+	// it is not available for this file.
+	fileTime    time.Time
+	hasFileTime bool
+	// times and longInfo are only set when needed for sorting
+	times    *FileTimes
+	longInfo *LongInfo
+	// collationKey is the collation key of path with --use-c-strcoll
+	collationKey []byte
+	// unknown is set for a symlink which couldn't be followed, only its
+	// name and type are shown, like GNU
+	unknown bool
 }
 
 type DisplayEntryList struct {
@@ -32,150 +44,512 @@ var now = time.Now()
 var showDirEntries bool
 var showAll bool
 var showAlmostAll bool
-var longList bool
 
 const (
-	name    int = iota
-	modTime int = iota
-	size    int = iota
+	formatUndefined  int = iota
+	formatVertical   int = iota
+	formatHorizontal int = iota
+	formatCommas     int = iota
+	formatOnePerLine int = iota
+	formatLong       int = iota
 )
 
-var sortType int = name
+// format is the selected output layout
+var format int = formatUndefined
+
+var formats = map[string]int{
+	"across":        formatHorizontal,
+	"commas":        formatCommas,
+	"horizontal":    formatHorizontal,
+	"long":          formatLong,
+	"single-column": formatOnePerLine,
+	"verbose":       formatLong,
+	"vertical":      formatVertical,
+}
+
+const (
+	timeMod    int = iota
+	timeAccess int = iota
+	timeChange int = iota
+	timeBirth  int = iota
+)
+
+var timeType int = timeMod
+
+// timeFormats holds the strftime formats used for long listing timestamps,
+// the first for non-recent files and the second for recent ones.
+var timeFormats = [2]string{"%b %e  %Y", "%b %e %H:%M"}
+var timeStyleSet bool
+
 var reverseSort bool
 var humanReadable bool
+var siUnits bool
+var showSize bool
+var showOwner bool = true
+var showGroup bool = true
+var showAuthor bool
+var showDriver bool
+
+// blockSize is the unit for -s and total lines, fileBlockSize the unit for
+// the long listing size column.
+var blockSize int64 = 1024
+var fileBlockSize int64 = 1
+var blockSizeSet bool
+var blockSuffix string
+var thousandsSep bool
 var recursiveList bool
 var onlyHidden bool
 var width int
-var oneColumn bool
-var listBylines bool
 var useCstrcoll bool
 var showInode bool
 var pathMode bool
+var flatRecursive bool
+var maxDepth int = -1
+var minDepth int
+var prunePatterns []string
+var oneFileSystem bool
+
+// fileId identifies a directory for detecting loops with -R, ok is false
+// when the backend can't identify files
+type fileId struct {
+	dev, ino uint64
+	ok       bool
+}
+
+func getFileId(fileName string, v os.FileInfo) fileId {
+	dev, ino, ok := GetFileId(fileName, v)
+	return fileId{dev, ino, ok}
+}
+
+// walkState is kept for each directory listed by -R
+type walkState struct {
+	// depth below the command line argument
+	depth int
+	// device of the command line argument
+	rootDev uint64
+	// parent directory, "" for a command line argument
+	parent string
+	id     fileId
+}
+
+var walkStates = make(map[string]walkState)
 var height int
 var wide bool
+
+// tabSize is the tab stop width used for padding, 0 to pad with spaces only
+var tabSize int = 8
+var tabSizeSet bool
+
+// eol ends each output line, NUL with --zero
+var eol = "\n"
 var pager bool
 
-var output io.Writer
+const (
+	indicatorNone     int = iota
+	indicatorSlash    int = iota
+	indicatorFileType int = iota
+	indicatorClassify int = iota
+)
 
-type colorDef struct {
-	fg, bg byte
-	bright bool
-}
+var indicatorStyle int = indicatorNone
 
-var fileColors map[string]colorDef
+const (
+	derefUndefined        int = iota
+	derefNever            int = iota
+	derefCommandLine      int = iota
+	derefCommandLineToDir int = iota
+	derefAlways           int = iota
+)
 
-var useColor bool
+var dereference int = derefUndefined
 
-var colorSet bool
+// short options which take an argument, given as -XARG or -X ARG, and the
+// long option they are equivalent to
+var shortArgOptions = map[byte]string{
+	'I': "--ignore",
+	'T': "--tabsize",
+}
 
-func setColor(def colorDef) {
-	colorSet = true
-	ct.ChangeColor(ct.Color(def.fg), def.bright, ct.Color(def.bg), false)
+// long options which can take their argument as the next command line
+// argument, as well as in --OPTION=ARG form
+var longArgOptions = map[string]bool{
+	"--ignore":      true,
+	"--hide":        true,
+	"--ignore-file": true,
+	"--prune":       true,
+	"--tabsize":     true,
 }
 
-func resetColor() {
-	if colorSet {
-		ct.ResetColor()
-		colorSet = false
+var ignorePatterns []string
+var hidePatterns []string
+var ignoreFile string
+
+// output buffers the listing, it is flushed before anything is logged so
+// errors appear in order with the listing
+var output *bufio.Writer
+
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	if output != nil {
+		output.Flush()
 	}
+	return os.Stderr.Write(p)
 }
 
-func setColorForFile(info os.FileInfo) {
-	mode := info.Mode()
-	var fileType string
+// indicator returns the suffix character appended to a file name for the
+// current indicator style, or "" if none applies.
+func indicator(mode os.FileMode) string {
+	if indicatorStyle == indicatorNone {
+		return ""
+	}
 	if mode&os.ModeDir != 0 {
-		if mode&os.ModeSticky != 0 {
-			if mode&(1<<1) != 0 {
-				fileType = "tw"
-			} else {
-				fileType = "st"
-			}
-		} else if mode&(1<<1) != 0 {
-			fileType = "ow"
-		} else {
-			fileType = "di"
-		}
-	} else if mode&os.ModeSymlink != 0 {
-		fileType = "ln"
+		return "/"
+	}
+	if indicatorStyle == indicatorSlash {
+		return ""
+	}
+	if mode&os.ModeSymlink != 0 {
+		return "@"
 	} else if mode&os.ModeNamedPipe != 0 {
-		fileType = "pi"
+		return "|"
 	} else if mode&os.ModeSocket != 0 {
-		fileType = "so"
-	} else if mode&os.ModeDevice != 0 {
-		fileType = "bd"
-	} else if mode&os.ModeCharDevice != 0 {
-		fileType = "cd"
-	} else if mode&os.ModeSetuid != 0 {
-		fileType = "su"
-	} else if mode&os.ModeSetgid != 0 {
-		fileType = "sg"
-	} else if mode&(1<<6|1<<3|1) != 0 {
-		fileType = "ex"
-	} else {
-		name := info.Name()
-		if n := strings.LastIndex(name, "."); n != -1 && n != len(name)-1 {
-			key := "*" + name[n:]
-			if _, ok := fileColors[key]; ok {
-				fileType = key
-			}
+		return "="
+	} else if mode&os.ModeType == 0 && mode&(1<<6|1<<3|1) != 0 && indicatorStyle == indicatorClassify {
+		return "*"
+	}
+	return ""
+}
+
+// statFile stats fileName, following symlinks as selected by dereference.
+// commandLine is true for file arguments given on the command line.
+func statFile(fileName string, commandLine bool) (os.FileInfo, error) {
+	if dereference == derefAlways || commandLine && dereference == derefCommandLine {
+		return os.Stat(fileName)
+	}
+	stat, err := os.Lstat(fileName)
+	if err == nil && commandLine && dereference == derefCommandLineToDir && stat.Mode()&os.ModeSymlink != 0 {
+		if target, err := os.Stat(fileName); err == nil && target.IsDir() {
+			return target, nil
 		}
 	}
-	if fileType != "" {
-		setColor(fileColors[fileType])
+	return stat, err
+}
+
+// shownAtDepth reports whether the entries of a directory depth levels below
+// a command line argument are listed. With -R directories above --min-depth
+// are only descended into, without -R the depth options have no effect.
+func shownAtDepth(depth int) bool {
+	return !recursiveList || depth >= minDepth
+}
+
+// descend reports whether -R should list the subdirectory dir, with file
+// info v, of parent. If so its walkState is recorded. An error is returned
+// if dir is one of its own ancestors, as can happen when following symlinks.
+func descend(dir string, v os.FileInfo, parent string) (bool, error) {
+	state := walkStates[parent]
+	if maxDepth >= 0 && state.depth+1 > maxDepth {
+		return false, nil
+	}
+	if matchPattern(prunePatterns, v.Name()) {
+		return false, nil
+	}
+	if oneFileSystem && GetDevice(v) != state.rootDev {
+		return false, nil
 	}
+	id := getFileId(dir, v)
+	for p := parent; id.ok && p != ""; p = walkStates[p].parent {
+		if walkStates[p].id == id {
+			return false, fmt.Errorf("%s: not listing already-listed directory", dir)
+		}
+	}
+	walkStates[dir] = walkState{state.depth + 1, state.rootDev, parent, id}
+	return true, nil
 }
 
-func human(n int64) string {
-	var i int64
-	var w = n
-	var uSize int64 = 1
-	for i = 0; i < 12; i++ {
-		if w/1024 == 0 {
-			break
+// dirPrefix returns the directory name with a trailing slash, for joining
+// with the names of its entries.
+func dirPrefix(dir string) string {
+	if strings.HasSuffix(dir, "/") {
+		return dir
+	}
+	return dir + "/"
+}
+
+// matchPattern reports whether name matches one of the shell glob patterns,
+// like fnmatch with FNM_PERIOD a leading period must be matched explicitly.
+func matchPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(pattern, ".") {
+			continue
+		}
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return true
 		}
-		w = w / 1024
-		uSize *= 1024
 	}
+	return false
+}
 
-	var f int64
-	var unit string
-	f = (n - w*uSize)
-	if f != 0 && i > 0 {
-		if w < 10 {
-			if f != 0 {
-				lowerSize := uSize / 1024
-				// magic plus one here (seems to be what GNU ls does)
-				tenth := int64(1024/10) + 1
-				f = f / lowerSize / tenth
-				// round up
-				f++
-				if f == 10 {
-					w++
-					f = 0
-				}
+// readIgnoreFile reads the patterns in fileName, one per line, ignoring
+// blank lines and lines starting with #.
+func readIgnoreFile(fileName string) []string {
+	var patterns []string
+	if data, err := os.ReadFile(fileName); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				patterns = append(patterns, line)
 			}
+		}
+	}
+	return patterns
+}
+
+// entryTime returns the time of type timeType for v, the bool is false if it
+// is unknown.
+func entryTime(v DisplayEntry, root string) (time.Time, bool) {
+	if v.unknown {
+		return time.Time{}, false
+	} else if timeType == timeMod {
+		return v.ModTime(), true
+	}
+	times := GetFileTimes(root+v.path, v.FileInfo)
+	switch timeType {
+	case timeAccess:
+		return times.Access, true
+	case timeChange:
+		return times.Change, true
+	}
+	return times.Birth, times.HasBirth
+}
+
+// a file is recent if its time stamp is within the last six months (half of
+// a Gregorian year), as in GNU ls
+const sixMonths = 31556952 / 2 * time.Second
+
+func timeString(v DisplayEntry) string {
+	if !v.hasFileTime {
+		return "?"
+	} else if humanReadable && !timeStyleSet {
+		return humanize.Time(v.fileTime)
+	} else if v.fileTime.After(now.Add(-sixMonths)) && !v.fileTime.After(now) {
+		return strftime(timeFormats[1], v.fileTime)
+	} else {
+		return strftime(timeFormats[0], v.fileTime)
+	}
+}
+
+// setTimeStyle sets timeFormats from a --time-style or TIME_STYLE value.
+func setTimeStyle(style string) {
+	if strings.HasPrefix(style, "posix-") {
+		// posix- styles only take effect outside of the POSIX locale
+		if isPosixLocale() {
+			style = "locale"
+		} else {
+			style = strings.TrimPrefix(style, "posix-")
+		}
+	}
+	switch style {
+	case "full-iso":
+		timeFormats = [2]string{"%Y-%m-%d %H:%M:%S.%N %z", "%Y-%m-%d %H:%M:%S.%N %z"}
+	case "long-iso":
+		timeFormats = [2]string{"%Y-%m-%d %H:%M", "%Y-%m-%d %H:%M"}
+	case "iso":
+		timeFormats = [2]string{"%Y-%m-%d ", "%m-%d %H:%M"}
+	case "locale":
+		timeFormats = [2]string{"%b %e  %Y", "%b %e %H:%M"}
+	default:
+		if !strings.HasPrefix(style, "+") {
+			log.Fatalf("invalid time style: %s", style)
+		}
+		// +FORMAT1<newline>FORMAT2 gives separate non-recent and recent formats
+		formats := strings.SplitN(style[1:], "\n", 2)
+		if len(formats) == 1 {
+			timeFormats = [2]string{formats[0], formats[0]}
 		} else {
-			// round up
+			timeFormats = [2]string{formats[0], formats[1]}
+		}
+	}
+	timeStyleSet = true
+}
+
+func isPosixLocale() bool {
+	for _, name := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			return v == "C" || v == "POSIX"
+		}
+	}
+	return true
+}
+
+// humanSize formats n bytes with a unit suffix in powers of base (1024 or
+// 1000), rounding up like GNU ls -h and --si.
+func humanSize(n int64, base int64) string {
+	if n < base {
+		return strconv.FormatInt(n, 10)
+	}
+	units := "KMGTPEZY"
+	if base == 1000 {
+		units = "kMGTPEZY"
+	}
+	var e int
+	var unitSize uint64 = 1
+	for uint64(n)/unitSize >= uint64(base) {
+		unitSize *= uint64(base)
+		e++
+	}
+	w := uint64(n) / unitSize
+	f := uint64(n) % unitSize
+	if w < 10 {
+		// one decimal place, rounded up
+		tenths := (f*10 + unitSize - 1) / unitSize
+		if tenths == 10 {
 			w++
+			tenths = 0
 		}
+		if w < 10 {
+			return fmt.Sprintf("%d.%d%c", w, tenths, units[e-1])
+		}
+	} else if f != 0 {
+		w++
+	}
+	if w == uint64(base) && e < len(units) {
+		return fmt.Sprintf("1.0%c", units[e])
 	}
+	return fmt.Sprintf("%d%c", w, units[e-1])
+}
 
-	switch i {
-	case 1:
-		unit = "K"
-	case 2:
-		unit = "M"
-	case 3:
-		unit = "G"
-	case 4:
-		unit = "T"
+// formatSize formats n bytes in units of unitSize, as set with --block-size.
+func formatSize(n int64, unitSize int64) string {
+	if humanReadable {
+		if siUnits {
+			return humanSize(n, 1000)
+		}
+		return humanSize(n, 1024)
+	}
+	v := n / unitSize
+	if n%unitSize != 0 {
+		v++
+	}
+	str := strconv.FormatInt(v, 10)
+	if thousandsSep {
+		for i := len(str) - 3; i > 0; i -= 3 {
+			str = str[:i] + "," + str[i:]
+		}
 	}
+	return str + blockSuffix
+}
 
-	if w > 0 && w < 10 {
-		return fmt.Sprintf("%d.%d%s", w, f, unit)
-	} else {
-		return fmt.Sprintf("%d%s", w, unit)
+// parseBlockSize parses a --block-size argument, such as 1K, MiB, 'kB or
+// 512, and sets blockSuffix and thousandsSep accordingly.
+func parseBlockSize(arg string) (int64, error) {
+	str := arg
+	thousandsSep = strings.HasPrefix(str, "'")
+	str = strings.TrimPrefix(str, "'")
+	blockSuffix = ""
+	switch str {
+	case "human-readable":
+		humanReadable = true
+		return 1, nil
+	case "si":
+		humanReadable = true
+		siUnits = true
+		return 1, nil
+	}
+	n := strings.IndexFunc(str, func(r rune) bool { return r < '0' || r > '9' })
+	if n == -1 {
+		n = len(str)
+	}
+	var count int64 = 1
+	if n > 0 {
+		var err error
+		if count, err = strconv.ParseInt(str[:n], 10, 64); err != nil || count == 0 {
+			return 0, fmt.Errorf("invalid --block-size argument '%s'", arg)
+		}
+	}
+	unit := str[n:]
+	if unit == "" {
+		return count, nil
+	}
+	exp := strings.IndexByte("KMGTPEZY", strings.ToUpper(unit)[0]) + 1
+	var base int64
+	switch unit[1:] {
+	case "", "iB":
+		base = 1024
+	case "B":
+		base = 1000
+	}
+	if exp == 0 || base == 0 {
+		return 0, fmt.Errorf("invalid suffix in --block-size argument '%s'", arg)
+	}
+	size := count
+	for i := 0; i < exp; i++ {
+		if size > (1<<63-1)/base {
+			return 0, fmt.Errorf("--block-size argument '%s' too large", arg)
+		}
+		size *= base
+	}
+	if n == 0 {
+		// sizes are shown with the unit if it was given without a number,
+		// spelled like GNU, K for 1024 and k for 1000 bytes
+		letter := string("KMGTPEZY"[exp-1])
+		if base == 1000 && exp == 1 {
+			letter = "k"
+		}
+		blockSuffix = letter + unit[1:]
+	}
+	return size, nil
+}
+
+func sizeString(v DisplayEntry) string {
+	if v.unknown {
+		return "?"
+	}
+	return formatSize(v.Size(), fileBlockSize)
+}
+
+// longFields are the columns of a long listing, other than sizes and times
+type longFields struct {
+	mode, links, user, group string
+}
+
+// longInfo returns the long listing columns of v, shown as ? if v is a
+// symlink which couldn't be followed.
+func longInfo(v DisplayEntry) longFields {
+	if v.unknown {
+		return longFields{modeString(v.Mode())[:1] + "?????????", "?", "?", "?"}
+	}
+	li := GetLongInfo(v)
+	return longFields{modeString(v.Mode()), strconv.Itoa(li.HardLinks), li.UserName, li.GroupName}
+}
+
+// deviceString returns the major and minor device numbers of a device file
+// padded to the given widths, in place of its size.
+func deviceString(v DisplayEntry, majorWidth, minorWidth int) string {
+	major, minor := GetDeviceNumbers(v.FileInfo)
+	return fmt.Sprintf("%*d, %*d", majorWidth, major, minorWidth, minor)
+}
+
+func driverString(v DisplayEntry) string {
+	if v.Mode()&os.ModeDevice == 0 {
+		return ""
+	}
+	major, _ := GetDeviceNumbers(v.FileInfo)
+	return DeviceDriver(major, v.Mode()&os.ModeCharDevice != 0)
+}
+
+func blocksString(v DisplayEntry) string {
+	if v.unknown {
+		return "?"
+	}
+	return formatSize(GetBlocks(v.FileInfo)*512, blockSize)
+}
+
+func inodeString(v DisplayEntry) string {
+	if v.unknown {
+		return "?"
 	}
+	return strconv.FormatUint(GetLongInfo(v).Ino, 10)
 }
 
 func decimalLen(n int64) (i int) {
@@ -229,6 +603,8 @@ func modeString(mode os.FileMode) string {
 		output[0] = 's'
 	} else if mode&os.ModeCharDevice != 0 && mode&os.ModeDevice != 0 {
 		output[0] = 'c'
+	} else if mode&os.ModeDevice != 0 {
+		output[0] = 'b'
 	}
 
 	const rwx = "rwxrwxrwx"
@@ -253,291 +629,297 @@ func modeString(mode os.FileMode) string {
 }
 
 func display(selected []DisplayEntry, root string) {
-	slice.Sort(selected, func(i, j int) (v bool) {
-		var same bool
-		if sortType == modTime {
-			v = selected[i].ModTime().Before(selected[j].ModTime())
-			if !v {
-				same = selected[i].ModTime().Equal(selected[j].ModTime())
-			}
-			v = !v
-		} else if sortType == size {
-			d := selected[j].Size() - selected[i].Size()
-			if d > 0 {
-				v = true
-			} else if d == 0 {
-				same = true
-			}
-			v = !v
-		} else {
-			// strcoll?
-			if !useCstrcoll {
-				v = strcmpi(selected[i].path, selected[j].path) == -1
-			} else {
-				v = Strcoll(selected[i].path, selected[j].path) < 0
-			}
+	sortEntries(selected, root)
+
+	var someQuoted bool
+	for i := range selected {
+		selected[i].name = quoteName(selected[i].path)
+		if isQuoted(selected[i].path, selected[i].name) {
+			someQuoted = true
 		}
-		if same {
-			if !useCstrcoll {
-				v = strcmpi(selected[i].path, selected[j].path) == -1
-			} else {
-				v = Strcoll(selected[i].path, selected[j].path) < 0
+	}
+	if someQuoted && quotesAlign() {
+		for i := range selected {
+			if !isQuoted(selected[i].path, selected[i].name) {
+				selected[i].name = " " + selected[i].name
 			}
 		}
+	}
 
-		if reverseSort {
-			v = !v
-		}
-		return
-	})
-
-	padding := 2
-	smallestWord := 1
-	var cols int
 	var colWidths []int
-	var wideColHeight int
 
-	if longList {
-		cols = 6
-		colWidths = make([]int, cols)
+	blockWidth := 0
+	if showSize {
 		for _, v := range selected {
-			li := GetLongInfo(v)
-			if decimalLen(int64(li.HardLinks)) > colWidths[0] {
-				colWidths[0] = decimalLen(int64(li.HardLinks))
+			if l := len(blocksString(v)); l > blockWidth {
+				blockWidth = l
 			}
-			if len(li.UserName) > colWidths[1] {
-				colWidths[1] = len(li.UserName)
+		}
+	}
+
+	if format == formatCommas {
+		// like GNU, block counts are not aligned
+		displayCommas(selected, root, 0)
+		return
+	} else if format != formatLong {
+		displayGrid(selected, root, blockWidth)
+		return
+	}
+
+	var majorWidth, minorWidth, driverWidth int
+	for _, v := range selected {
+		if v.Mode()&os.ModeDevice != 0 {
+			major, minor := GetDeviceNumbers(v.FileInfo)
+			if decimalLen(int64(major)) > majorWidth {
+				majorWidth = decimalLen(int64(major))
 			}
-			if len(li.GroupName) > colWidths[2] {
-				colWidths[2] = len(li.GroupName)
+			if decimalLen(int64(minor)) > minorWidth {
+				minorWidth = decimalLen(int64(minor))
 			}
-			if humanReadable {
-				if len(human(v.Size())) > colWidths[3] {
-					colWidths[3] = len(human(v.Size()))
-				}
-				if len(humanize.Time(v.ModTime())) > colWidths[4] {
-					colWidths[4] = len(humanize.Time(v.ModTime()))
-				}
-			} else {
-				if decimalLen(v.Size()) > colWidths[3] {
-					colWidths[3] = decimalLen(v.Size())
-				}
-			}
-			if showInode {
-				dl := decimalLen(int64(li.Ino))
-				if dl > colWidths[5] {
-					colWidths[5] = dl
-				}
+			if showDriver && len(driverString(v)) > driverWidth {
+				driverWidth = len(driverString(v))
 			}
 		}
-	} else {
-		if oneColumn {
-			cols = 1
-		} else if wide {
-			wideColHeight = height - 2
-			cols = len(selected) / wideColHeight
-			if len(selected) % wideColHeight != 0 {
-				cols++
-			}
+	}
+
+	colWidths = make([]int, 6)
+	if majorWidth > 0 {
+		colWidths[3] = majorWidth + 2 + minorWidth
+	}
+	for _, v := range selected {
+		li := longInfo(v)
+		if len(li.links) > colWidths[0] {
+			colWidths[0] = len(li.links)
+		}
+		if w := displayWidth(li.user); (showOwner || showAuthor) && w > colWidths[1] {
+			colWidths[1] = w
+		}
+		if w := displayWidth(li.group); showGroup && w > colWidths[2] {
+			colWidths[2] = w
+		}
+		if len(timeString(v)) > colWidths[4] {
+			colWidths[4] = len(timeString(v))
+		}
+		if v.Mode()&os.ModeDevice == 0 && len(sizeString(v)) > colWidths[3] {
+			colWidths[3] = len(sizeString(v))
+		}
+		if showInode && len(inodeString(v)) > colWidths[5] {
+			colWidths[5] = len(inodeString(v))
+		}
+	}
+
+	for _, v := range selected {
+		linkTarget, brokenLink, linkInfo := readLink(root, v)
+
+		li := longInfo(v)
+		timeStr := timeString(v)
+		timePad := strings.Repeat(" ", colWidths[4]-len(timeStr))
+		linkPad := strings.Repeat(" ", colWidths[0]-len(li.links))
+		var ownerStr string
+		if showOwner {
+			ownerStr += li.user + strings.Repeat(" ", colWidths[1]-displayWidth(li.user)) + " "
+		}
+		if showGroup {
+			ownerStr += li.group + strings.Repeat(" ", colWidths[2]-displayWidth(li.group)) + " "
+		}
+		if showAuthor {
+			// the author of a file is its owner on Unix
+			ownerStr += li.user + strings.Repeat(" ", colWidths[1]-displayWidth(li.user)) + " "
+		}
+		var sizeStr string
+		if v.Mode()&os.ModeDevice != 0 {
+			sizeStr = deviceString(v, majorWidth, minorWidth)
 		} else {
-			cols = width / (padding + smallestWord)
-		}
-		colWidths = make([]int, cols)
-	A:
-		for {
-			colWidths = colWidths[:cols]
-			for i := range colWidths {
-				colWidths[i] = 0
-			}
-			pos := (cols - 1) * padding
-			for i := range selected {
-				p := i % cols
-				var j int
-				if listBylines {
-					j = i
-				} else {
-					var per int
-					if wide {
-						per = wideColHeight
-					} else if len(selected) % cols == 0 {
-						per = len(selected) / cols
-					} else {
-						per = len(selected) / cols + 1
-					}
-					square := per * cols
-					if len(selected) <= square - per {
-						cols--
-						if cols == 0 {
-							cols = 1
-							break A
-						}
-						continue A
-					}
-					// if needed skip empty rows in last column
-					// lastFullRow is index of last row with all cols present
-					lastFullRow := (len(selected) - 1) % per
-					curRow := i / cols
-					if curRow > lastFullRow  {
-						diff := (i - (lastFullRow + 1) * cols)
-						p = diff % (cols - 1)
-						curRow = lastFullRow + 1 + diff / (cols - 1)
-					}
-					j = (per * p) + curRow
+			sizeStr = sizeString(v)
+		}
+		sizePad := strings.Repeat(" ", colWidths[3]-len(sizeStr))
+		if driverWidth > 0 {
+			driver := driverString(v)
+			sizeStr += " " + driver + strings.Repeat(" ", driverWidth-len(driver))
+		}
+
+		inodeStr := ""
+		if showInode {
+			inodeStr = strings.Repeat(" ", colWidths[5]-len(inodeString(v))) + inodeString(v) + " "
+		}
+		if showSize {
+			blocks := blocksString(v)
+			inodeStr += strings.Repeat(" ", blockWidth-len(blocks)) + blocks + " "
+		}
+		if useColor {
+			setNormalColor()
+			fmt.Fprintf(output, "%s%s %s%s %s%s%s %s%s ", inodeStr, li.mode, linkPad,
+				li.links, ownerStr, sizePad, sizeStr, timePad, timeStr)
+			color, colored := entryColor(root, v, brokenLink, linkInfo)
+			printColored(v.name, color, colored)
+			if linkTarget != "" {
+				fmt.Fprintf(output, " -> ")
+				target := path.Join(path.Dir(root+v.path), linkTarget)
+				if path.IsAbs(linkTarget) {
+					target = linkTarget
 				}
-				v := selected[j]
-				l := len(v.path)
-				if showInode {
-					li := GetLongInfo(v)
-					l += decimalLen(int64(li.Ino)) + 1
+				color, colored := fileColor(target, linkInfo, false, true)
+				printColored(quoteName(linkTarget), color, colored)
+				if linkInfo != nil {
+					fmt.Fprint(output, indicator(linkInfo.Mode()))
 				}
-				if l > colWidths[p] {
-					pos += l - colWidths[p]
-					if pos > width && !wide {
-						cols--
-						if cols == 0 {
-							cols = 1
-							break A
-						}
-						continue A
-					}
-					colWidths[p] = l
+			} else if v.Mode()&os.ModeSymlink == 0 {
+				fmt.Fprint(output, indicator(v.Mode()))
+			}
+			fmt.Fprint(output, eol)
+		} else {
+			name := v.name
+			if v.Mode()&os.ModeSymlink != 0 && !v.unknown {
+				name = name + " -> " + quoteName(linkTarget)
+				if linkInfo != nil {
+					name += indicator(linkInfo.Mode())
 				}
+			} else {
+				name += indicator(v.Mode())
 			}
-			break
+			fmt.Fprintf(output, "%s%s %s%s %s%s%s %s%s %s%s", inodeStr, li.mode, linkPad,
+				li.links, ownerStr, sizePad, sizeStr, timePad, timeStr, name, eol)
 		}
 	}
+}
 
-	for i := range selected {
-		var j int
-		adjCols := cols
-		p := i % cols
-		if listBylines || longList {
-			j = i
+// indent pads the output from column from to column to, using tabs where
+// possible if tabSize is set.
+func indent(from, to int) {
+	for from < to {
+		if tabSize != 0 && to/tabSize > (from+1)/tabSize {
+			fmt.Fprint(output, "\t")
+			from += tabSize - from%tabSize
 		} else {
-			var per int
-			if wide  {
-				per = wideColHeight
-			} else if len(selected) % cols == 0 {
-				per = len(selected) / cols
-			} else {
-				per = len(selected) / cols + 1
-			}
-			lastFullRow := (len(selected) - 1) % per
-			curRow := i / cols
-			if curRow > lastFullRow {
-				adjCols = cols - 1
-				diff := (i - (lastFullRow + 1) * cols)
-				p = diff % (cols - 1)
-				curRow = lastFullRow + 1 + diff / (cols - 1)
-			}
-			j = (per * p) + curRow
-		}
-		v := selected[j]
-		var linkTarget string
-		var brokenLink bool
-		var linkInfo os.FileInfo
-		if v.Mode()&os.ModeSymlink != 0 {
-			if l, err := os.Readlink(root + v.path); err == nil {
-				linkTarget = l
-				if i, err := os.Stat(root + v.path); err != nil {
-					brokenLink = true
-				} else {
-					linkInfo = i
-				}
-			} else {
-				log.Print(err)
-			}
+			fmt.Fprint(output, " ")
+			from++
 		}
+	}
+}
 
-		if longList {
-			li := GetLongInfo(v)
-			var timeStr string
-			timePad := ""
-			if humanReadable {
-				timeStr = humanize.Time(v.ModTime())
-				timePad = strings.Repeat(" ", colWidths[4]-len(timeStr))
-			} else if now.Year() == v.ModTime().Year() {
-				timeStr = v.ModTime().Format("Jan _2 15:04")
-			} else {
-				timeStr = v.ModTime().Format("Jan _2  2006")
-			}
-			linkPad := strings.Repeat(" ", colWidths[0]-decimalLen(int64(li.HardLinks)))
-			userPad := strings.Repeat(" ", colWidths[1]-len(li.UserName))
-			groupPad := strings.Repeat(" ", colWidths[2]-len(li.GroupName))
-			var sizeStr string
-			if humanReadable {
-				sizeStr = human(v.Size())
+// displayCommas lists selected separated by commas, filling each line up to
+// width.
+func displayCommas(selected []DisplayEntry, root string, blockWidth int) {
+	pos := 0
+	for i, v := range selected {
+		l := entryWidth(v, blockWidth)
+		if i != 0 {
+			// like GNU, a width of 0 means no limit
+			if width <= 0 || pos+l+2 < width {
+				fmt.Fprint(output, ", ")
+				pos += 2
 			} else {
-				sizeStr = fmt.Sprintf("%d", v.Size())
+				fmt.Fprint(output, ","+eol)
+				pos = 0
 			}
+		}
+		pos += printEntry(v, root, blockWidth)
+	}
+	fmt.Fprint(output, eol)
+}
 
-			sizePad := strings.Repeat(" ", colWidths[3]-len(sizeStr))
-
-			inodeStr := ""
-			if showInode {
-				inodeStr = strings.Repeat(" ", colWidths[5]-decimalLen(int64(li.Ino))) + fmt.Sprintf("%d ", li.Ino)
-			}
-			if useColor {
-				fmt.Fprintf(output, "%s%s %s%d %s%s %s%s %s%s %s%s ", inodeStr, modeString(v.Mode()), linkPad,
-					li.HardLinks, li.UserName, userPad, li.GroupName, groupPad, sizePad, sizeStr, timePad, timeStr)
-				if brokenLink {
-					setColor(fileColors["or"])
-				} else {
-					setColorForFile(v.FileInfo)
-				}
-				fmt.Fprintf(output, "%s", v.path)
-				resetColor()
-				if linkTarget != "" {
-					fmt.Fprintf(output, " -> ")
-					if brokenLink {
-						setColor(fileColors["or"])
-					} else {
-						setColorForFile(linkInfo)
-					}
-					fmt.Fprintf(output, "%s", linkTarget)
-					resetColor()
-				}
-				fmt.Fprintln(output)
+// readLink returns the target of v if it is a symlink, whether the target
+// exists and if so its file info.
+func readLink(root string, v DisplayEntry) (linkTarget string, brokenLink bool, linkInfo os.FileInfo) {
+	if v.Mode()&os.ModeSymlink != 0 && !v.unknown {
+		if l, err := os.Readlink(root + v.path); err == nil {
+			linkTarget = l
+			if i, err := os.Stat(root + v.path); err != nil {
+				brokenLink = true
 			} else {
-				name := v.path
-				if v.Mode()&os.ModeSymlink != 0 {
-					name = name + " -> " + linkTarget
-				}
-				fmt.Fprintf(output, "%s%s %s%d %s%s %s%s %s%s %s%s %s\n", inodeStr, modeString(v.Mode()), linkPad,
-					li.HardLinks, li.UserName, userPad, li.GroupName, groupPad, sizePad, sizeStr, timePad, timeStr, name)
+				linkInfo = i
 			}
 		} else {
-			w := colWidths[p]
-			if p == 0 {
-				if i != 0 {
-					fmt.Fprintln(output)
-				}
-			}
-			if useColor {
-				if brokenLink {
-					setColor(fileColors["or"])
-				} else {
-					setColorForFile(v.FileInfo)
-				}
-			}
-			l := len(v.path)
-			if showInode {
-				li := GetLongInfo(v)
-				l += decimalLen(int64(li.Ino)) + 1
-				fmt.Fprintf(output, "%d ", li.Ino)
-			}
-			fmt.Fprintf(output, "%s", v.path)
-			if useColor {
-				resetColor()
-			}
-			if p != adjCols-1 {
-				fmt.Fprint(output, strings.Repeat(" ", (w-l)+padding))
-			}
+			log.Print(err)
 		}
 	}
-	if !longList {
-		fmt.Fprintln(output)
+	return
+}
+
+// entryWidth returns the width of v as printed by printEntry, with the block
+// count padded to at least blockWidth.
+func entryWidth(v DisplayEntry, blockWidth int) int {
+	l := displayWidth(v.name) + len(indicator(v.Mode()))
+	if showInode {
+		l += len(inodeString(v)) + 1
 	}
+	if showSize {
+		if n := len(blocksString(v)); n > blockWidth {
+			blockWidth = n
+		}
+		l += blockWidth + 1
+	}
+	return l
+}
+
+// printEntry prints the name of v with its inode number, size in blocks and
+// indicator if enabled, returning the printed width.
+func printEntry(v DisplayEntry, root string, blockWidth int) int {
+	if useColor {
+		setNormalColor()
+	}
+	if showInode {
+		fmt.Fprintf(output, "%s ", inodeString(v))
+	}
+	if showSize {
+		blocks := blocksString(v)
+		if len(blocks) < blockWidth {
+			blocks = strings.Repeat(" ", blockWidth-len(blocks)) + blocks
+		}
+		fmt.Fprintf(output, "%s ", blocks)
+	}
+	if useColor {
+		_, brokenLink, linkInfo := readLink(root, v)
+		color, colored := entryColor(root, v, brokenLink, linkInfo)
+		printColored(v.name, color, colored)
+	} else {
+		fmt.Fprintf(output, "%s", v.name)
+	}
+	fmt.Fprint(output, indicator(v.Mode()))
+	return entryWidth(v, blockWidth)
+}
+
+// envSize returns the value of the environment variable name if it is set to
+// a positive number, or 0.
+func envSize(name string) int {
+	if env := os.Getenv(name); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n > 0 {
+			return n
+		}
+		log.Printf("ignoring invalid value of environment variable %s: %s", name, env)
+	}
+	return 0
+}
+
+// terminalSize returns the width and height to lay out output for. Like GNU
+// the size of the terminal on standard output is used, then COLUMNS and
+// LINES, then the size of the terminal on standard error or the controlling
+// terminal, and failing all of those 80x25.
+func terminalSize() (int, int) {
+	if w, h, err := GetTermSize(os.Stdout); err == nil {
+		return w, h
+	}
+
+	w, h := envSize("COLUMNS"), envSize("LINES")
+	if w == 0 || h == 0 {
+		tw, th, err := GetTermSize(os.Stderr)
+		if err != nil {
+			if tty, err2 := OpenTerminal(); err2 == nil {
+				tw, th, err = GetTermSize(tty)
+				tty.Close()
+			}
+		}
+		if err != nil {
+			tw, th = 80, 25
+		}
+		if w == 0 {
+			w = tw
+		}
+		if h == 0 {
+			h = th
+		}
+	}
+	return w, h
 }
 
 func main() {
@@ -548,8 +930,40 @@ func main() {
 	files.Remove(0)
 	for iter := files.Iterator(0); iter.Next(); {
 		if v := files.Data[iter.Pos()]; strings.HasPrefix(v, "-") {
-			options.Data[options.Append()] = v
 			iter.Remove()
+			// option whose argument is the next command line argument
+			var argOption string
+			if longArgOptions[v] {
+				argOption = v + "="
+			} else if !strings.HasPrefix(v, "--") {
+				for n := 1; n < len(v); n++ {
+					if long, ok := shortArgOptions[v[n]]; ok {
+						// remaining letters are the argument
+						if n > 1 {
+							options.Data[options.Append()] = v[:n]
+						}
+						if n+1 < len(v) {
+							options.Data[options.Append()] = long + "=" + v[n+1:]
+						} else {
+							argOption = long + "="
+						}
+						v = ""
+						break
+					}
+				}
+				if v != "" {
+					options.Data[options.Append()] = v
+				}
+			} else {
+				options.Data[options.Append()] = v
+			}
+			if argOption != "" {
+				if !iter.Next() {
+					log.Fatalf("option requires an argument %s", strings.TrimSuffix(argOption, "="))
+				}
+				options.Data[options.Append()] = argOption + files.Data[iter.Pos()]
+				iter.Remove()
+			}
 			if v == "--" {
 				break
 			}
@@ -560,18 +974,20 @@ func main() {
 		files.Data[files.Append()] = "."
 	}
 
-	if !IsTerminal(1) {
-		oneColumn = true
-	}
+	setAmbiguousWidth()
 
-	if w, h, err := GetTermSize(); err == nil {
-		width = w
-		height = h
-	} else {
-		width = 80
-		height = 25
+	if env := os.Getenv("TABSIZE"); env != "" {
+		if n, err := strconv.Atoi(env); err == nil && n >= 0 {
+			tabSize = n
+		} else {
+			log.Printf("ignoring invalid tab size in environment variable TABSIZE: %s", env)
+		}
 	}
 
+	// measured before output is redirected to the pager, so the pager's
+	// terminal is measured rather than the pipe to it
+	width, height = terminalSize()
+
 	for iter := options.Iterator(0); iter.Next(); {
 		if option := options.Data[iter.Pos()]; !strings.HasPrefix(option, "--") && len(option) > 2 {
 			letters := sindex.InitListType(&sindex.ByteList{Data: []byte(option[1:])}).(*sindex.ByteList)
@@ -592,23 +1008,138 @@ Sort entries alphabetically unless a sort option is given.
 	-a					do not ignore entries starting with .
 	-A					do not list implied . and ..
 	-d					list directory entries instead of contents
-	-t					sort by modification time, newest first
-	-S					sort by file size
+	-t					sort by time, newest first; see --time
+	-u					with -lt: sort by, and show, access time;
+						with -l: show access time and sort by name;
+						otherwise: sort by access time, newest first
+	-c					with -lt: sort by, and show, ctime (time of last
+						change of file status information);
+						with -l: show ctime and sort by name;
+						otherwise: sort by ctime, newest first
+	--time=WORD				select which timestamp is used to display or sort;
+						access time (-u): atime, access, use;
+						change time (-c): ctime, status;
+						birth time: birth, creation;
+						with -l, WORD determines which time to show;
+						with -t, WORD determines which time to sort by
+	-S					sort by file size, largest first
+	-X					sort alphabetically by entry extension
+	-v					natural sort of (version) numbers within text
+	-U					do not sort; list entries in directory order
+	-f					list all entries in directory order, like -a -U,
+						disables -l, -s and --color
+	--sort=WORD				sort by WORD instead of name: none (-U), size (-S),
+						time (-t), version (-v), extension (-X), width,
+						inode, links, owner, group, atime, ctime, birth;
+						WORD may be a comma separated list of keys, each
+						prefixed with - to reverse it, eg. --sort=ext,-size
+	--group-directories-first		group directories before files, can be used
+						with --sort, but --sort=none (-U) disables grouping
+	--case-sensitive			sort names case sensitively, in character code
+						order, instead of ignoring case
 	-r					reverse order while sorting
 	-l					use a long listing format
-	-h					with -l, print sizes, time stamps in human readable format
-	-R					list subdirectories recursively, sorting all files
-	-P					when used with -R, enables path mode, only file paths are displayed
+	-g					like -l, but do not list owner
+	-o					like -l, but do not list group information
+	-G, --no-group				in a long listing, don't print group names
+	-n, --numeric-uid-gid			like -l, but list numeric user and group IDs
+	-L, --dereference			when showing file information for a symbolic
+						link, show information for the file the link
+						references rather than for the link itself
+	-H, --dereference-command-line		follow symbolic links listed on the command line
+	--dereference-command-line-symlink-to-dir
+						follow each command line symbolic link
+						that points to a directory
+	--author				with -l, print the author of each file
+	--device-driver				with -l, print the driver name of device files
+						from /proc/devices after their device numbers
+	-h					with -l and -s, print sizes like 1K 234M 2G etc,
+						with -l, print time stamps in human readable format
+	--si					likewise, but use powers of 1000 not 1024
+	-s, --size				print the allocated size of each file, in blocks
+	-k					default to 1024-byte blocks for file system usage;
+						used only with -s and per directory totals
+	--block-size=SIZE			with -l, scale sizes by SIZE when printing them;
+						e.g., '--block-size=M'; SIZE is an integer and
+						optional unit (K,M,G,T,P,E or KB,MB,...), a leading
+						' prints thousands separators
+	-R, --recursive				list subdirectories recursively
+	--flat					when used with -R, list all files in one listing
+						sorted by path, instead of a section per directory
+	--max-depth=N				with -R, descend at most N levels of directories
+	--min-depth=N				with -R, do not list directories less than N
+						levels below the command line arguments
+	--prune=PATTERN				with -R, do not descend into directories matching
+						shell PATTERN
+	--one-file-system, --xdev		with -R, do not descend into directories on
+						other file systems
+	-P					when used with -R, enables path mode, only file paths
+						are displayed, implies --flat
 	-O					only list entries starting with .
+	-I, --ignore=PATTERN			do not list implied entries matching shell PATTERN
+	--hide=PATTERN				do not list implied entries matching shell PATTERN
+						(overridden by -a or -A)
+	-B, --ignore-backups			do not list implied entries ending with ~
+	--ignore-file=NAME			do not list implied entries matching the shell
+						patterns in file NAME, one per line, in the
+						directory being listed, eg. .lsignore
 	-C					list entries by columns
 	-x					list entries by lines instead of by columns
 	-1					list one file per line
+	-m					fill width with a comma separated list of entries
+	--format=WORD				across -x, commas -m, horizontal -x, long -l,
+						single-column -1, verbose -l, vertical -C
+	--zero					end each output line with NUL, not newline
+	-F, --classify[=WHEN]			append indicator (one of */=@|) to entries WHEN
+						defaults to 'always' or can be "never" or "auto"
+	--file-type				likewise, except do not append '*'
+	-p					append / indicator to directories
+	--indicator-style=WORD			append indicator with style WORD to entry names:
+						none, slash (-p), file-type (--file-type),
+						classify (-F)
 	-i, --inode				print the index number of each file
-	--width=COLS				assume screen width
+	--full-time				like -l --time-style=full-iso
+	--time-style=TIME_STYLE			time/date format with -l; TIME_STYLE is one of
+						full-iso, long-iso, iso, locale, or +FORMAT;
+						FORMAT is interpreted like in date(1), if FORMAT
+						is FORMAT1<newline>FORMAT2, then FORMAT1 applies
+						to non-recent files and FORMAT2 to recent files;
+						TIME_STYLE prefixed with 'posix-' takes effect
+						only outside the POSIX locale; the TIME_STYLE
+						environment variable sets the default style and
+						TZ selects the time zone
+	-b, --escape				print C-style escapes for nongraphic characters
+	-N, --literal				print entry names without quoting
+	-q, --hide-control-chars		print ? instead of nongraphic characters
+	--show-control-chars			show nongraphic characters as-is (the default,
+						unless program is 'ls' and output is a terminal)
+	-Q, --quote-name			enclose entry names in double quotes
+	--quoting-style=WORD			use quoting style WORD for entry names:
+						literal, locale, shell, shell-always,
+						shell-escape, shell-escape-always, c, escape
+						(overrides QUOTING_STYLE environment variable)
+	-T, --tabsize=COLS			assume tab stops at each COLS instead of 8,
+						0 pads with spaces only
+	--width=COLS				assume screen width, 0 means no limit; defaults
+						to the terminal width, or COLUMNS if standard
+						output is not a terminal
 	--color[=WHEN]				colorize the output WHEN defaults to 'always'
-						or can be "never" or "auto".
-	--use-c-strcoll				use strcoll by making C call from Go when sorting file names
+						or can be "never" or "auto"; without --color, a
+						non empty NO_COLOR disables color, otherwise
+						CLICOLOR_FORCE acts like --color=always (without
+						needing CLICOLOR) and CLICOLOR like --color=auto,
+						each unless empty or 0;
+						colors are read from $XDG_CONFIG_HOME/ls/dircolors
+						or ~/.dircolors in dircolors(1) format, then the
+						BSD LSCOLORS, then LS_COLORS
+	--print-colors				print the LS_COLORS value for the color settings
+						and a table of the colors, then exit
+	--use-c-strcoll				sort file names in the collation order of the locale
+						set by LC_ALL, LC_COLLATE or LANG, like strcoll,
 						instead of native string comparison function
+	--nss-fallback[=yes|no]			in builds without cgo, look up user and group ids
+						which are not in /etc/passwd or /etc/group with
+						getent(1), the default is yes
 	--help					display this help and exit
 `
 		option := options.Data[iter.Pos()]
@@ -621,28 +1152,111 @@ Sort entries alphabetically unless a sort option is given.
 			showAlmostAll = true
 			showAll = true
 		case "-t":
-			sortType = modTime
+			sortKeys = []sortKey{{sortTime, false}}
 		case "-S":
-			sortType = size
+			sortKeys = []sortKey{{sortSize, false}}
+		case "-v":
+			sortKeys = []sortKey{{sortVersion, false}}
+		case "-X":
+			sortKeys = []sortKey{{sortExtension, false}}
+		case "-U":
+			sortKeys = []sortKey{{sortNone, false}}
+		case "-f":
+			// like GNU, -a -U without long listing, sizes or colors
+			showAll = true
+			showAlmostAll = false
+			sortKeys = []sortKey{{sortNone, false}}
+			if format == formatLong {
+				format = formatUndefined
+			}
+			showSize = false
+			useColor = false
+			colorSet = true
+		case "--group-directories-first":
+			groupDirectories = true
+		case "--case-sensitive":
+			caseSensitive = true
+		case "-u", "--time=atime", "--time=access", "--time=use":
+			timeType = timeAccess
+		case "-c", "--time=ctime", "--time=status":
+			timeType = timeChange
+		case "--time=birth", "--time=creation":
+			timeType = timeBirth
+		case "--time=mtime", "--time=modification":
+			timeType = timeMod
 		case "-r":
 			reverseSort = true
 		case "-l":
-			longList = true
+			format = formatLong
+		case "--full-time":
+			format = formatLong
+			setTimeStyle("full-iso")
+		case "-g":
+			format = formatLong
+			showOwner = false
+		case "-o":
+			format = formatLong
+			showGroup = false
+		case "-G", "--no-group":
+			showGroup = false
+		case "-n", "--numeric-uid-gid":
+			format = formatLong
+			ResolveNames = false
+		case "-L", "--dereference":
+			dereference = derefAlways
+		case "-H", "--dereference-command-line":
+			dereference = derefCommandLine
+		case "--dereference-command-line-symlink-to-dir":
+			dereference = derefCommandLineToDir
+		case "--author":
+			showAuthor = true
+		case "--device-driver":
+			showDriver = true
 		case "-h":
 			humanReadable = true
-		case "-R":
+			siUnits = false
+		case "--si":
+			humanReadable = true
+			siUnits = true
+		case "-s", "--size":
+			showSize = true
+		case "-k":
+			blockSize = 1024
+			blockSizeSet = true
+		case "-R", "--recursive":
 			recursiveList = true
+		case "--flat":
+			flatRecursive = true
+		case "--one-file-system", "--xdev":
+			oneFileSystem = true
 		case "-P":
 			pathMode = true
+			flatRecursive = true
 		case "-O":
 			onlyHidden = true
+		case "-B", "--ignore-backups":
+			ignorePatterns = append(ignorePatterns, "*~", ".*~")
 		case "-x":
-			listBylines = true
+			format = formatHorizontal
 		case "-C":
-			listBylines = false
-			oneColumn = false
+			format = formatVertical
 		case "-1":
-			oneColumn = true
+			format = formatOnePerLine
+		case "-m":
+			format = formatCommas
+		case "--zero":
+			// like GNU, --zero implies one entry per line unless listing
+			// in long format, without colors or quoting
+			eol = "\x00"
+			if format != formatLong {
+				format = formatOnePerLine
+			}
+			useColor = false
+			colorSet = true
+			hideControlChars = false
+			hideControlCharsSet = true
+			quotingStyle = quoteLiteral
+			quotingStyleSet = true
 		case "--inode":
 			fallthrough
 		case "-i":
@@ -653,22 +1267,66 @@ Sort entries alphabetically unless a sort option is given.
 			fallthrough
 		case "--color=always":
 			useColor = true
+			colorSet = true
 		case "--color=never":
 			useColor = false
+			colorSet = true
 		case "--color=auto":
-			if IsTerminal(1) {
+			if IsTerminal(os.Stdout) {
 				useColor = true
 			} else {
 				useColor = false
 			}
+			colorSet = true
+		case "--print-colors":
+			printColorTable = true
 		case "--use-c-strcoll":
 			fallthrough
 		case "--use-c-strcoll=yes":	
 			useCstrcoll = true
 		case "--use-c-strcoll=no":
 			useCstrcoll = false
+		case "--nss-fallback", "--nss-fallback=yes":
+			NSSFallback = true
+		case "--nss-fallback=no":
+			NSSFallback = false
 		case "--pager":
 			pager = true
+		case "-F":
+			fallthrough
+		case "--classify":
+			fallthrough
+		case "--classify=always", "--classify=yes", "--classify=force":
+			indicatorStyle = indicatorClassify
+		case "--classify=never", "--classify=no", "--classify=none":
+			indicatorStyle = indicatorNone
+		case "--classify=auto", "--classify=tty", "--classify=if-tty":
+			if IsTerminal(os.Stdout) {
+				indicatorStyle = indicatorClassify
+			} else {
+				indicatorStyle = indicatorNone
+			}
+		case "--file-type":
+			indicatorStyle = indicatorFileType
+		case "-p":
+			indicatorStyle = indicatorSlash
+		case "-b", "--escape":
+			quotingStyle = quoteEscape
+			quotingStyleSet = true
+		case "-N", "--literal":
+			quotingStyle = quoteLiteral
+			quotingStyleSet = true
+		case "-Q", "--quote-name":
+			quotingStyle = quoteC
+			quotingStyleSet = true
+		case "-q", "--hide-control-chars":
+			hideControlChars = true
+			hideControlCharsSet = true
+		case "--show-control-chars":
+			hideControlChars = false
+			hideControlCharsSet = true
+		case "--":
+			// end of options
 		case "--help":
 			fmt.Print(helpStr)
 			os.Exit(0)
@@ -683,72 +1341,177 @@ Sort entries alphabetically unless a sort option is given.
 				if _, err := fmt.Sscanf(numStr, "%d", &height); err != nil {
 					log.Fatalf("invalid line width: %s", numStr)
 				}
+			} else if strings.HasPrefix(option, "--ignore=") {
+				ignorePatterns = append(ignorePatterns, strings.TrimPrefix(option, "--ignore="))
+			} else if strings.HasPrefix(option, "--hide=") {
+				hidePatterns = append(hidePatterns, strings.TrimPrefix(option, "--hide="))
+			} else if strings.HasPrefix(option, "--ignore-file=") {
+				ignoreFile = strings.TrimPrefix(option, "--ignore-file=")
+			} else if strings.HasPrefix(option, "--max-depth=") {
+				numStr := strings.TrimPrefix(option, "--max-depth=")
+				if _, err := fmt.Sscanf(numStr, "%d", &maxDepth); err != nil || maxDepth < 0 {
+					log.Fatalf("invalid depth: %s", numStr)
+				}
+			} else if strings.HasPrefix(option, "--min-depth=") {
+				numStr := strings.TrimPrefix(option, "--min-depth=")
+				if _, err := fmt.Sscanf(numStr, "%d", &minDepth); err != nil || minDepth < 0 {
+					log.Fatalf("invalid depth: %s", numStr)
+				}
+			} else if strings.HasPrefix(option, "--prune=") {
+				prunePatterns = append(prunePatterns, strings.TrimPrefix(option, "--prune="))
+			} else if strings.HasPrefix(option, "--quoting-style=") {
+				style, ok := quotingStyles[strings.TrimPrefix(option, "--quoting-style=")]
+				if !ok {
+					log.Fatalf("invalid quoting style: %s", strings.TrimPrefix(option, "--quoting-style="))
+				}
+				quotingStyle = style
+				quotingStyleSet = true
+			} else if strings.HasPrefix(option, "--tabsize=") {
+				numStr := strings.TrimPrefix(option, "--tabsize=")
+				if _, err := fmt.Sscanf(numStr, "%d", &tabSize); err != nil || tabSize < 0 {
+					log.Fatalf("invalid tab size: %s", numStr)
+				}
+				tabSizeSet = true
+			} else if strings.HasPrefix(option, "--sort=") {
+				keys, err := parseSortKeys(strings.TrimPrefix(option, "--sort="))
+				if err != nil {
+					log.Fatal(err)
+				}
+				sortKeys = keys
+			} else if strings.HasPrefix(option, "--format=") {
+				f, ok := formats[strings.TrimPrefix(option, "--format=")]
+				if !ok {
+					log.Fatalf("invalid format: %s", strings.TrimPrefix(option, "--format="))
+				}
+				format = f
+			} else if strings.HasPrefix(option, "--block-size=") {
+				n, err := parseBlockSize(strings.TrimPrefix(option, "--block-size="))
+				if err != nil {
+					log.Fatal(err)
+				}
+				blockSize = n
+				fileBlockSize = n
+				blockSizeSet = true
+			} else if strings.HasPrefix(option, "--time-style=") {
+				setTimeStyle(strings.TrimPrefix(option, "--time-style="))
+			} else if strings.HasPrefix(option, "--indicator-style=") {
+				switch style := strings.TrimPrefix(option, "--indicator-style="); style {
+				case "none":
+					indicatorStyle = indicatorNone
+				case "slash":
+					indicatorStyle = indicatorSlash
+				case "file-type":
+					indicatorStyle = indicatorFileType
+				case "classify":
+					indicatorStyle = indicatorClassify
+				default:
+					log.Fatalf("invalid indicator style: %s", style)
+				}
 			} else {
 				log.Fatalf("unknown option %s", option)
 			}
 		}
 	}
 
-	if useColor {
-		colorBytesMap := map[string][]byte{
-			"di": {1, 34},
-			"ln": {1, 36},
-			"pi": {40, 33},
-			"so": {1, 35},
-			"bd": {40, 33, 1},
-			"cd": {40, 33, 1},
-			"or": {40, 31},
-			"su": {37, 41},
-			"sg": {30, 43},
-			"tw": {30, 42},
-			"ow": {34, 42},
-			"st": {37, 44},
-			"ex": {01, 32},
-		}
-		lsColorsEnv := os.Getenv("LS_COLORS")
-		colorDefs := strings.Split(lsColorsEnv, ":")
-		for _, def := range colorDefs {
-			tokens := strings.Split(def, "=")
-			if len(tokens) != 2 {
-				continue
-			}
-			colors := strings.Split(tokens[1], ";")
-			var colorBytes []byte
-			for _, color := range colors {
-				if n, err := strconv.ParseInt(color, 10, 8); err == nil {
-					colorBytes = append(colorBytes, byte(n))
-				}
+	if format == formatUndefined {
+		if !IsTerminal(os.Stdout) || eol == "\x00" {
+			format = formatOnePerLine
+		} else {
+			format = formatVertical
+		}
+	}
+
+	// like GNU, symlinks to directories given on the command line are
+	// followed unless listing directory entries, classifying or using a
+	// long listing
+	if dereference == derefUndefined {
+		if showDirEntries || indicatorStyle == indicatorClassify || format == formatLong {
+			dereference = derefNever
+		} else {
+			dereference = derefCommandLineToDir
+		}
+	}
+
+	if !quotingStyleSet {
+		if env := os.Getenv("QUOTING_STYLE"); env != "" {
+			if style, ok := quotingStyles[env]; ok {
+				quotingStyle = style
+			} else {
+				log.Printf("ignoring invalid value of environment variable QUOTING_STYLE: %s", env)
 			}
-			colorBytesMap[tokens[0]] = colorBytes
-		}
-		fileColors = make(map[string]colorDef)
-		for k, v := range colorBytesMap {
-			var bright bool
-			var fg, bg int = 0, 0
-			for _, b := range v {
-				if b == 0 {
-					bright = false
-				} else if b == 1 {
-					bright = true
-				} else if b >= 30 && b < 38 {
-					fg = int(b-30) + 1
-				} else if b >= 40 && b < 48 {
-					bg = int(b-40) + 1
+		} else if IsTerminal(os.Stdout) {
+			quotingStyle = quoteShellEscape
+		}
+	}
+	if !hideControlCharsSet {
+		hideControlChars = IsTerminal(os.Stdout)
+	}
+
+	if !blockSizeSet {
+		for _, name := range []string{"LS_BLOCK_SIZE", "BLOCK_SIZE"} {
+			if env := os.Getenv(name); env != "" {
+				if n, err := parseBlockSize(env); err == nil {
+					blockSize = n
+					fileBlockSize = n
 				}
+				break
 			}
-			fileColors[k] = colorDef{byte(fg), byte(bg), bright}
+		}
+		if os.Getenv("LS_BLOCK_SIZE") == "" && os.Getenv("BLOCK_SIZE") == "" && os.Getenv("POSIXLY_CORRECT") != "" {
+			blockSize = 512
 		}
 	}
 
-	output = os.Stdout
+	if !timeStyleSet {
+		if style := os.Getenv("TIME_STYLE"); style != "" {
+			setTimeStyle(style)
+		}
+	}
+
+	// like GNU, -u, -c and --time sort by that time unless showing a long
+	// listing or another sort order was chosen
+	if timeType != timeMod && format != formatLong && sortKeys == nil {
+		sortKeys = []sortKey{{sortTime, false}}
+	}
+
+	if useCstrcoll {
+		collator = NewCollator(Locale())
+	}
+
+	// like GNU, an unlimited line width is padded with spaces only
+	if width <= 0 {
+		tabSize = 0
+	}
+
+	if !colorSet {
+		useColor = colorFromEnv()
+	}
+
+	if useColor {
+		// like GNU, don't use tabs with color by default as some terminals
+		// can't handle tabs and color codes on the same line
+		if !tabSizeSet {
+			tabSize = 0
+		}
+	}
+	if useColor || printColorTable {
+		loadColors()
+	}
+
+	log.SetOutput(logWriter{})
+	output = bufio.NewWriter(os.Stdout)
+	if printColorTable {
+		printColors(useColor || IsTerminal(os.Stdout))
+		output.Flush()
+		os.Exit(0)
+	}
 	var onexit func()
 	if pager {
 		pr, pw, err := os.Pipe()
 		if err != nil {
 			log.Fatal(err)
 		}
-		output = pw
-		ct.Writer = output
+		output = bufio.NewWriter(pw)
 		cmd := exec.Command("less")
 		cmd.Stdout = os.Stdout
 		cmd.Stdin = pr
@@ -770,19 +1533,20 @@ Sort entries alphabetically unless a sort option is given.
 	for iter := files.Iterator(0); iter.Next(); {
 		fileName := files.Data[iter.Pos()]
 		if showDirEntries {
-			if stat, err := os.Lstat(fileName); err == nil {
-				selected.Data[selected.Append()] = DisplayEntry{fileName, stat}
+			if stat, err := statFile(fileName, true); err == nil {
+				selected.Data[selected.Append()] = DisplayEntry{path: fileName, FileInfo: stat}
 			} else {
 				log.Print(err)
 				exit = 2
 			}
 			iter.Remove()
 		} else {
-			if stat, err := os.Lstat(fileName); err == nil {
+			if stat, err := statFile(fileName, true); err == nil {
 				if stat.IsDir() {
+					walkStates[fileName] = walkState{0, GetDevice(stat), "", getFileId(fileName, stat)}
 					continue
 				} else {
-					selected.Data[selected.Append()] = DisplayEntry{fileName, stat}
+					selected.Data[selected.Append()] = DisplayEntry{path: fileName, FileInfo: stat}
 					iter.Remove()
 				}
 			} else {
@@ -793,58 +1557,84 @@ Sort entries alphabetically unless a sort option is given.
 		}
 	}
 
-	if selected.Len() > 0 && !recursiveList {
+	if selected.Len() > 0 && !(recursiveList && flatRecursive) {
 		display(selected.Data, "")
 	}
 
 	// directories
+	flat := recursiveList && flatRecursive
+	printed := selected.Len() > 0
 	for iter := files.Iterator(0); iter.Next(); {
 		fileName := files.Data[iter.Pos()]
+		shown := shownAtDepth(walkStates[fileName].depth)
 
-		if !recursiveList {
-			if selected.Len() > 0 {
-				selected.Clear()
+		if !flat && shown {
+			if printed {
 				fmt.Fprintln(output)
-				fmt.Fprintf(output, "%s:\n", fileName)
-			} else if files.Len() > 1 {
-				fmt.Fprintf(output, "%s:\n", fileName)
 			}
+			if printed || recursiveList || files.Len() > 1 {
+				fmt.Fprintf(output, "%s:\n", quoteName(fileName))
+			}
+			printed = true
+		}
+		if !flat {
+			selected.Clear()
 		}
 
 		var total int64 = 0
 		if file, err := os.Open(fileName); err == nil {
-			if showAll && !showAlmostAll && !recursiveList && !onlyHidden {
+			if showAll && !showAlmostAll && !flat && !onlyHidden {
 				if stat, err := os.Stat(fileName); err == nil {
-					selected.Data[selected.Append()] = DisplayEntry{".", stat}
+					selected.Data[selected.Append()] = DisplayEntry{path: ".", FileInfo: stat}
 				} else {
 					log.Print(err)
 				}
 				if parent, err := os.Stat(path.Clean(fileName + "/..")); err == nil {
-					selected.Data[selected.Append()] = DisplayEntry{"..", parent}
+					selected.Data[selected.Append()] = DisplayEntry{path: "..", FileInfo: parent}
 				} else {
 					log.Print(err)
 				}
 			}
+			ignored := ignorePatterns
+			if ignoreFile != "" {
+				ignored = append(readIgnoreFile(fileName+"/"+ignoreFile), ignored...)
+			}
 			if names, err := file.Readdirnames(0); err == nil {
 				for _, name := range names {
 					isHidden := strings.HasPrefix(name, ".")
+					if matchPattern(ignored, name) || !showAll && matchPattern(hidePatterns, name) {
+						continue
+					}
 					if !onlyHidden && (showAll || !isHidden) || onlyHidden && isHidden {
-						if v, err := os.Lstat(fileName + "/" + name); err == nil {
-							total += v.Size()
-							if recursiveList {
+						if v, err := statFile(fileName+"/"+name, false); err == nil {
+							if flat {
 								path := path.Clean(fileName + "/" + v.Name())
-								if !v.IsDir() || !pathMode {
-									selected.Data[selected.Append()] = DisplayEntry{path, v}
+								if shown && (!v.IsDir() || !pathMode) {
+									selected.Data[selected.Append()] = DisplayEntry{path: path, FileInfo: v}
 								}
 								if v.IsDir() {
-									files.Data[files.Append()] = path
+									if ok, err := descend(path, v, fileName); ok {
+										files.Data[files.Append()] = path
+									} else if err != nil {
+										log.Print(err)
+										exit = 2
+									}
 								}
 							} else {
-								selected.Data[selected.Append()] = DisplayEntry{v.Name(), v}
+								selected.Data[selected.Append()] = DisplayEntry{path: v.Name(), FileInfo: v}
 							}
 						} else {
 							log.Print(err)
 							exit = 1
+							// like GNU, a symlink which can't be followed is
+							// listed with only its name and type
+							if v, err := os.Lstat(fileName + "/" + name); err == nil && (!flat || shown) {
+								p := v.Name()
+								if flat {
+									p = path.Clean(fileName + "/" + p)
+								}
+								selected.Data[selected.Append()] = DisplayEntry{path: p, FileInfo: v, unknown: true}
+							}
 						}
 					}
 				}
@@ -858,24 +1648,51 @@ Sort entries alphabetically unless a sort option is given.
 			exit = 1
 		}
 
-		if longList && !recursiveList {
-			if humanReadable {
-				fmt.Fprintf(output, "total %s\n", human(total))
-			} else {
-				fmt.Fprintf(output, "total %d\n", total/1024)
+		if (format == formatLong || showSize) && !flat && shown {
+			for _, v := range selected.Data {
+				if !v.unknown {
+					total += GetBlocks(v.FileInfo)
+				}
 			}
+			fmt.Fprintf(output, "total %s%s", formatSize(total*512, blockSize), eol)
 		}
 
-		if !recursiveList && selected.Len() > 0 {
-			display(selected.Data, fileName+"/")
+		if !flat && selected.Len() > 0 {
+			if shown {
+				display(selected.Data, dirPrefix(fileName))
+			} else {
+				sortEntries(selected.Data, dirPrefix(fileName))
+			}
+
+			// selected is sorted, list subdirectories next in that order,
+			// before the remaining directories
+			if recursiveList {
+				pos := iter.Pos() + 1
+				for _, v := range selected.Data {
+					if !v.IsDir() || v.path == "." || v.path == ".." {
+						continue
+					}
+					dir := dirPrefix(fileName) + v.path
+					if ok, err := descend(dir, v.FileInfo, fileName); ok {
+						files.Data[files.Insert(pos)] = dir
+						pos++
+					} else if err != nil {
+						log.Print(err)
+						exit = 2
+					}
+				}
+			}
 		}
 	}
 
-	if recursiveList && selected.Len() > 0 {
-//		log.Printf("sorting/displaying")
+	if flat && selected.Len() > 0 {
 		display(selected.Data, "")
 	}
 
+	if useColor {
+		finishColor()
+	}
+	output.Flush()
 	if pager {
 		onexit()
 	}
@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+func TestParseBlockSize(t *testing.T) {
+	defer func(s string, sep bool) {
+		blockSuffix, thousandsSep = s, sep
+	}(blockSuffix, thousandsSep)
+
+	for _, tc := range []struct {
+		arg    string
+		size   int64
+		suffix string
+		sep    bool
+	}{
+		{"512", 512, "", false},
+		{"1K", 1024, "", false},
+		{"K", 1024, "K", false},
+		{"k", 1024, "K", false},
+		{"KiB", 1024, "KiB", false},
+		{"kiB", 1024, "KiB", false},
+		{"KB", 1000, "kB", false},
+		{"kB", 1000, "kB", false},
+		{"M", 1 << 20, "M", false},
+		{"mB", 1000000, "MB", false},
+		{"MiB", 1 << 20, "MiB", false},
+		{"'1", 1, "", true},
+		{"'kB", 1000, "kB", true},
+	} {
+		size, err := parseBlockSize(tc.arg)
+		if err != nil {
+			t.Errorf("parseBlockSize(%q): %v", tc.arg, err)
+			continue
+		}
+		if size != tc.size || blockSuffix != tc.suffix || thousandsSep != tc.sep {
+			t.Errorf("parseBlockSize(%q) = %d, suffix %q, separator %v, want %d, %q, %v",
+				tc.arg, size, blockSuffix, thousandsSep, tc.size, tc.suffix, tc.sep)
+		}
+	}
+
+	for _, arg := range []string{"0", "X", "1KX", "KiBB", "99999999999999999999"} {
+		if _, err := parseBlockSize(arg); err == nil {
+			t.Errorf("parseBlockSize(%q) succeeded, want an error", arg)
+		}
+	}
+}
+
+func TestShownAtDepth(t *testing.T) {
+	defer func(r bool, min int) {
+		recursiveList, minDepth = r, min
+	}(recursiveList, minDepth)
+
+	for _, tc := range []struct {
+		recursive bool
+		minDepth  int
+		depth     int
+		want      bool
+	}{
+		// --min-depth has no effect without -R
+		{false, 1, 0, true},
+		{false, 2, 0, true},
+		{true, 0, 0, true},
+		{true, 1, 0, false},
+		{true, 1, 1, true},
+		{true, 2, 1, false},
+		{true, 2, 3, true},
+	} {
+		recursiveList, minDepth = tc.recursive, tc.minDepth
+		if got := shownAtDepth(tc.depth); got != tc.want {
+			t.Errorf("shownAtDepth(%d) with -R %v, --min-depth=%d = %v, want %v",
+				tc.depth, tc.recursive, tc.minDepth, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	quoteLiteral           int = iota
+	quoteLocale            int = iota
+	quoteCLocale           int = iota
+	quoteShell             int = iota
+	quoteShellAlways       int = iota
+	quoteShellEscape       int = iota
+	quoteShellEscapeAlways int = iota
+	quoteC                 int = iota
+	quoteEscape            int = iota
+)
+
+var quotingStyles = map[string]int{
+	"literal":             quoteLiteral,
+	"locale":              quoteLocale,
+	"clocale":             quoteCLocale,
+	"shell":               quoteShell,
+	"shell-always":        quoteShellAlways,
+	"shell-escape":        quoteShellEscape,
+	"shell-escape-always": quoteShellEscapeAlways,
+	"c":                   quoteC,
+	"escape":              quoteEscape,
+}
+
+var quotingStyle int = quoteLiteral
+var quotingStyleSet bool
+
+// hideControlChars replaces nonprintable characters left unescaped by the
+// quoting style with '?', as with -q.
+var hideControlChars bool
+var hideControlCharsSet bool
+
+// shellSpecial are the characters which need quoting in shell quoting styles
+const shellSpecial = " \t\n\v\f\r!\"$&'()*;<>?[\\]^`{|}"
+
+// isPrintable reports whether r, decoded from a string taking size bytes,
+// can be written to a terminal as is. Like glibc iswprint only invalid UTF-8
+// and the C0 and C1 control characters are rejected, so that format
+// characters such as the zero width joiner in emoji sequences and variation
+// selectors are shown.
+func isPrintable(r rune, size int) bool {
+	if r == utf8.RuneError && size == 1 {
+		return false
+	}
+	return r >= ' ' && r != 0x7f && !(r >= 0x80 && r < 0xa0)
+}
+
+// hideNonprintable replaces each nonprintable character and invalid byte of
+// s with '?'.
+func hideNonprintable(s string) string {
+	var b strings.Builder
+	for i, w := 0, 0; i < len(s); i += w {
+		var r rune
+		r, w = utf8.DecodeRuneInString(s[i:])
+		if isPrintable(r, w) {
+			b.WriteString(s[i : i+w])
+		} else {
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// quoteName returns name quoted with the current quoting style.
+func quoteName(name string) string {
+	var quoted string
+	switch quotingStyle {
+	case quoteLiteral:
+		quoted = name
+	case quoteShell, quoteShellAlways:
+		if quotingStyle == quoteShellAlways || needsShellQuote(name) {
+			quoted = shellQuote(name)
+		} else {
+			quoted = name
+		}
+	case quoteShellEscape, quoteShellEscapeAlways:
+		quoted = shellEscape(name, quotingStyle == quoteShellEscapeAlways)
+	case quoteC:
+		quoted = `"` + cEscape(name, '"', false) + `"`
+	case quoteEscape:
+		quoted = cEscape(name, 0, true)
+	case quoteLocale, quoteCLocale:
+		left, right := localeQuotes()
+		quoted = left + cEscape(name, []rune(right)[0], false) + right
+	}
+	if hideControlChars {
+		quoted = hideNonprintable(quoted)
+	}
+	return quoted
+}
+
+// quotesAlign reports whether unquoted names should be indented by a space to
+// line up with quoted ones, as GNU ls does for shell and c quoting styles.
+func quotesAlign() bool {
+	switch quotingStyle {
+	case quoteShell, quoteShellEscape, quoteC:
+		return format != formatOnePerLine && format != formatCommas
+	}
+	return false
+}
+
+// isQuoted reports whether quoteName quoted name, rather than returning it
+// unchanged or only escaped.
+func isQuoted(name, quoted string) bool {
+	return quoted != name && strings.IndexAny(quoted[:1], `'"$`) == 0
+}
+
+// needsShellQuote reports whether name contains shell metacharacters or
+// starts with '#' or '~'. Like GNU nonprintable characters don't count, the
+// shell style leaves them as is or -q replaces them with '?' afterwards.
+func needsShellQuote(name string) bool {
+	if name == "" || strings.HasPrefix(name, "#") || strings.HasPrefix(name, "~") {
+		return true
+	}
+	return strings.ContainsAny(name, shellSpecial)
+}
+
+// hasNonprintable reports whether s contains nonprintable characters or
+// invalid UTF-8.
+func hasNonprintable(s string) bool {
+	for i, w := 0, 0; i < len(s); i += w {
+		var r rune
+		r, w = utf8.DecodeRuneInString(s[i:])
+		if !isPrintable(r, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// shellQuote quotes s in single quotes, or double quotes if it contains
+// single quotes but nothing special inside double quotes.
+func shellQuote(s string) string {
+	if strings.Contains(s, "'") && !strings.ContainsAny(s, "\"$`\\!") {
+		return `"` + s + `"`
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// shellEscape quotes name for the shell, nonprintable characters are
+// written as $'\ooo' so the result is safe to paste into a shell.
+func shellEscape(name string, always bool) string {
+	if !always && !needsShellQuote(name) && !hasNonprintable(name) {
+		return name
+	}
+	var b strings.Builder
+	var printable, escaped strings.Builder
+	flush := func() {
+		if printable.Len() > 0 {
+			b.WriteString(shellQuote(printable.String()))
+			printable.Reset()
+		}
+		if escaped.Len() > 0 {
+			b.WriteString("$'" + escaped.String() + "'")
+			escaped.Reset()
+		}
+	}
+	for i, w := 0, 0; i < len(name); i += w {
+		var r rune
+		r, w = utf8.DecodeRuneInString(name[i:])
+		if isPrintable(r, w) {
+			if escaped.Len() > 0 {
+				flush()
+			}
+			printable.WriteString(name[i : i+w])
+		} else {
+			if printable.Len() > 0 {
+				flush()
+			}
+			escaped.WriteString(cEscape(name[i:i+w], 0, false))
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// cEscape escapes backslashes, quote and nonprintable characters in s with C
+// style backslash escapes, and also spaces if escapeSpace is set.
+func cEscape(s string, quote rune, escapeSpace bool) string {
+	var b strings.Builder
+	for i, w := 0, 0; i < len(s); i += w {
+		var r rune
+		r, w = utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == quote && quote != 0:
+			if quote == '"' || quote == '\'' {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		case r == ' ' && escapeSpace:
+			b.WriteString(`\ `)
+		case r == '\a':
+			b.WriteString(`\a`)
+		case r == '\b':
+			b.WriteString(`\b`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\v':
+			b.WriteString(`\v`)
+		case !isPrintable(r, w):
+			for j := i; j < i+w; j++ {
+				fmt.Fprintf(&b, "\\%03o", s[j])
+			}
+		default:
+			b.WriteString(s[i : i+w])
+		}
+	}
+	return b.String()
+}
+
+// localeQuotes returns the quotation marks for the locale quoting styles.
+func localeQuotes() (string, string) {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			v = strings.ToLower(v)
+			if strings.Contains(v, "utf-8") || strings.Contains(v, "utf8") {
+				return "‘", "’"
+			}
+			break
+		}
+	}
+	if quotingStyle == quoteCLocale {
+		return `"`, `"`
+	}
+	return "'", "'"
+}
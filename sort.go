@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bradfitz/slice"
+	. "github.com/timob/ls/lib"
+	"os"
+	"strings"
+)
+
+const (
+	sortNone      int = iota
+	sortName      int = iota
+	sortSize      int = iota
+	sortTime      int = iota
+	sortVersion   int = iota
+	sortExtension int = iota
+	sortWidth     int = iota
+	sortInode     int = iota
+	sortLinks     int = iota
+	sortOwner     int = iota
+	sortGroup     int = iota
+	sortAtime     int = iota
+	sortCtime     int = iota
+	sortBirth     int = iota
+)
+
+var sortWords = map[string]int{
+	"none":      sortNone,
+	"name":      sortName,
+	"size":      sortSize,
+	"time":      sortTime,
+	"version":   sortVersion,
+	"extension": sortExtension,
+	"ext":       sortExtension,
+	"width":     sortWidth,
+	"inode":     sortInode,
+	"links":     sortLinks,
+	"owner":     sortOwner,
+	"group":     sortGroup,
+	"atime":     sortAtime,
+	"ctime":     sortCtime,
+	"birth":     sortBirth,
+}
+
+// sortKey is one key of the sort order, reverse inverts the key's natural
+// direction, e.g. size sorts largest first unless reversed.
+type sortKey struct {
+	key     int
+	reverse bool
+}
+
+// sortKeys are compared in order, ties are broken by name. nil sorts by name
+// only, as when no sort option is given.
+var sortKeys []sortKey
+
+var groupDirectories bool
+var caseSensitive bool
+
+// collator orders names in the locale's collation order with
+// --use-c-strcoll, nil otherwise
+var collator *Collator
+
+// parseSortKeys parses a --sort argument, a comma separated list of sort
+// words each optionally prefixed with - to reverse it, e.g. ext,-size.
+func parseSortKeys(arg string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, word := range strings.Split(arg, ",") {
+		var k sortKey
+		if strings.HasPrefix(word, "-") {
+			k.reverse = true
+			word = word[1:]
+		}
+		key, ok := sortWords[word]
+		if !ok {
+			return nil, fmt.Errorf("invalid sort key: %s", word)
+		}
+		k.key = key
+		keys = append(keys, k)
+	}
+	if len(keys) > 1 {
+		for _, k := range keys {
+			if k.key == sortNone {
+				return nil, fmt.Errorf("sort key none can't be combined with other keys: %s", arg)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func unsorted() bool {
+	return len(sortKeys) == 1 && sortKeys[0].key == sortNone
+}
+
+func compareNames(a, b string) int {
+	if caseSensitive {
+		return strings.Compare(a, b)
+	} else if collator != nil {
+		return collator.Compare(a, b)
+	}
+	return strcmpi(a, b)
+}
+
+// compareEntryNames compares the names of a and b like compareNames, using
+// their precomputed collation keys when collating.
+func compareEntryNames(a, b *DisplayEntry) int {
+	if collator != nil && !caseSensitive {
+		if c := bytes.Compare(a.collationKey, b.collationKey); c != 0 {
+			return c
+		}
+		return strings.Compare(a.path, b.path)
+	}
+	return compareNames(a.path, b.path)
+}
+
+// extension returns the extension of name, starting at its last '.', as in
+// GNU ls a dotfile without another '.' is all extension.
+func extension(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i:]
+	}
+	return ""
+}
+
+func compareInts(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// compareKey compares a and b by key in its natural direction.
+func compareKey(a, b *DisplayEntry, key int) int {
+	switch key {
+	case sortName:
+		return compareEntryNames(a, b)
+	case sortSize:
+		return compareInts(b.Size(), a.Size())
+	case sortTime:
+		return compareInts(b.fileTime.UnixNano(), a.fileTime.UnixNano())
+	case sortVersion:
+		return Filevercmp(a.path, b.path)
+	case sortExtension:
+		return compareNames(extension(a.path), extension(b.path))
+	case sortWidth:
+		return compareInts(int64(displayWidth(a.name)), int64(displayWidth(b.name)))
+	case sortInode:
+		ai, bi := GetInode(a.FileInfo), GetInode(b.FileInfo)
+		if ai < bi {
+			return -1
+		} else if ai > bi {
+			return 1
+		}
+		return 0
+	case sortLinks:
+		return compareInts(int64(b.longInfo.HardLinks), int64(a.longInfo.HardLinks))
+	case sortOwner:
+		return compareNames(a.longInfo.UserName, b.longInfo.UserName)
+	case sortGroup:
+		return compareNames(a.longInfo.GroupName, b.longInfo.GroupName)
+	case sortAtime:
+		return compareInts(b.times.Access.UnixNano(), a.times.Access.UnixNano())
+	case sortCtime:
+		return compareInts(b.times.Change.UnixNano(), a.times.Change.UnixNano())
+	case sortBirth:
+		return compareInts(b.times.Birth.UnixNano(), a.times.Birth.UnixNano())
+	}
+	return 0
+}
+
+func compareEntries(a, b *DisplayEntry) int {
+	for _, k := range sortKeys {
+		c := compareKey(a, b, k.key)
+		if k.reverse {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareEntryNames(a, b)
+}
+
+// isDirectory reports whether v is a directory or a symlink to one, for
+// --group-directories-first.
+func isDirectory(v DisplayEntry, root string) bool {
+	if v.IsDir() {
+		return true
+	}
+	if v.Mode()&os.ModeSymlink != 0 {
+		if info, err := os.Stat(root + v.path); err == nil {
+			return info.IsDir()
+		}
+	}
+	return false
+}
+
+// sortEntries sorts selected by the current sort order. The time of each
+// entry is filled in, even when not sorting, for the long format.
+func sortEntries(selected []DisplayEntry, root string) {
+	for i := range selected {
+		v := &selected[i]
+		v.fileTime, v.hasFileTime = entryTime(*v, root)
+	}
+	if unsorted() {
+		return
+	}
+
+	if collator != nil {
+		collator.Reset()
+	}
+	for i := range selected {
+		v := &selected[i]
+		if collator != nil {
+			v.collationKey = collator.Key(v.path)
+		}
+		for _, k := range sortKeys {
+			switch k.key {
+			case sortWidth:
+				v.name = quoteName(v.path)
+			case sortLinks, sortOwner, sortGroup:
+				v.longInfo = GetLongInfo(v.FileInfo)
+			case sortAtime, sortCtime, sortBirth:
+				v.times = GetFileTimes(root+v.path, v.FileInfo)
+			}
+		}
+	}
+
+	sortPart := func(part []DisplayEntry) {
+		slice.Sort(part, func(i, j int) bool {
+			if reverseSort {
+				return compareEntries(&part[j], &part[i]) < 0
+			}
+			return compareEntries(&part[i], &part[j]) < 0
+		})
+	}
+
+	if groupDirectories {
+		// move directories to the front, keeping their order, then sort
+		// directories and other files separately
+		var dirs int
+		var others []DisplayEntry
+		for _, v := range selected {
+			if isDirectory(v, root) {
+				selected[dirs] = v
+				dirs++
+			} else {
+				others = append(others, v)
+			}
+		}
+		copy(selected[dirs:], others)
+		sortPart(selected[:dirs])
+		sortPart(selected[dirs:])
+	} else {
+		sortPart(selected)
+	}
+}
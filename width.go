@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	textwidth "golang.org/x/text/width"
+)
+
+// ambiguousWidth is the number of cells used by East Asian ambiguous width
+// characters, 2 in CJK locales and 1 otherwise.
+var ambiguousWidth = 1
+
+// setAmbiguousWidth sets ambiguousWidth from the locale, as terminals in CJK
+// locales usually draw ambiguous characters double width.
+func setAmbiguousWidth() {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			for _, prefix := range []string{"ja", "ko", "zh"} {
+				if strings.HasPrefix(v, prefix) {
+					ambiguousWidth = 2
+				}
+			}
+			return
+		}
+	}
+}
+
+// displayWidth returns the number of terminal cells used to display s.
+// Combining marks and format characters take no cells, characters joined to
+// the previous one with a zero width joiner, as in emoji sequences, are drawn
+// as one cluster, and a pair of regional indicators draws one flag.
+func displayWidth(s string) int {
+	var w, lastWidth int
+	var joined, flagHalf bool
+	for i, size := 0, 0; i < len(s); i += size {
+		var r rune
+		r, size = utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			// invalid byte
+			w++
+			lastWidth = 1
+			continue
+		}
+		if joined {
+			joined = false
+			continue
+		}
+		if r < 0x1F1E6 || r > 0x1F1FF {
+			flagHalf = false
+		}
+		switch {
+		case r == 0x200D:
+			joined = true
+		case r == 0xFE0F:
+			// emoji presentation selector widens the previous character
+			if lastWidth == 1 {
+				w++
+				lastWidth = 2
+			}
+		case r >= 0x1F3FB && r <= 0x1F3FF:
+			// emoji skin tone modifier
+		case r >= 0x1F1E6 && r <= 0x1F1FF:
+			if !flagHalf {
+				w += 2
+			}
+			flagHalf = !flagHalf
+			lastWidth = 2
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf), r >= 0x1160 && r <= 0x11FF:
+			// combining, format and Hangul medial and final jamo
+		case !unicode.IsPrint(r) && r != ' ':
+			// control characters
+		default:
+			lastWidth = runeWidth(r)
+			w += lastWidth
+		}
+	}
+	return w
+}
+
+func runeWidth(r rune) int {
+	switch textwidth.LookupRune(r).Kind() {
+	case textwidth.EastAsianWide, textwidth.EastAsianFullwidth:
+		return 2
+	case textwidth.EastAsianAmbiguous:
+		return ambiguousWidth
+	}
+	return 1
+}